@@ -1,8 +1,17 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/shirou/gopsutil/v3/net"
 	"github.com/shirou/gopsutil/v3/process"
@@ -10,82 +19,617 @@ import (
 )
 
 var (
-	killPid  int32
-	killPort int
+	killPids      []int32
+	killPorts     []string
+	killNames     []string
+	killCmdline   string
+	killUser      string
+	killSignal    string
+	killGrace     time.Duration
+	killYes       bool
+	killTree      bool
+	killParent    bool
+	killDryRun    bool
+	killForce     bool
+	killContainer string
+	killOutput    string
+	killStale     bool
+	killIdle      time.Duration
+
+	// killLog receives progress messages; with --output json it is stderr
+	// so that stdout holds only the JSON.
+	killLog io.Writer = os.Stdout
+)
+
+// Exit codes of devtool kill, besides 0 for success and 1 for other errors.
+const (
+	killExitNotFound     = 2
+	killExitPermission   = 3
+	killExitStillRunning = 4
 )
 
 // killCmd represents the kill command
 var killCmd = &cobra.Command{
 	Use:   "kill",
-	Short: "Kill a process by PID or Port",
-	Long: `Kill a process by specifying its Process ID (PID) or the Port it is listening on.
-Safe and easy way to terminate rogue processes during development.`,
-	Example: `  devtool kill --pid 1234
-  devtool kill --port 8080`,
+	Short: "Kill processes by PID, Port, name or command line",
+	Long: `Kill processes by specifying their Process ID (PID), a Port they are listening on,
+their name or their command line.
+Safe and easy way to terminate rogue processes during development.
+
+--pid, --port and --name can be repeated or given comma separated lists, and
+--port accepts ranges such as 3000-3010. --name matches the process name
+exactly or as a glob (node*), --cmdline matches the full command line with a
+regular expression, and --user limits every match to one user's processes.
+When more than one process is selected, or when matching by name or command
+line, the processes are listed first; on a terminal devtool asks for
+confirmation before killing several processes unless --yes is given.
+
+Without any of these flags on a terminal, devtool opens a picker listing the
+listening processes (PID, name, ports, user, memory and command). Type to fuzzy
+filter, move with the arrow keys, press Tab to select several processes and
+Enter to kill the selection (or the highlighted process); Esc cancels.
+
+Each process is first sent SIGTERM so it can shut down cleanly. Any that are
+still running after --grace are killed with SIGKILL. Use --signal to send a
+different signal; HUP, USR1 and the like are sent once without escalation.
+When killing by port, devtool checks that the ports were released afterwards.
+
+Killing only the server often just makes a watcher restart it. --tree also
+kills every descendant of the selected processes, children first. --parent
+walks up from each process to the dev tool that launched it (npm, yarn, pnpm,
+nodemon, air, go run, cargo watch, foreman and similar, looking through the
+"sh -c" wrappers they use) and kills that tool with all its children.
+
+When a port is published by a container, killing the process holding it
+(docker-proxy, rootlessport or similar) would leave a broken container behind.
+Instead devtool finds the container through the Docker or Podman API and
+stops it; on a terminal it asks whether to stop or remove the container, stop
+its whole compose service or kill the process anyway. --container picks the
+action up front: stop, rm, service or process.
+
+--stale looks for forgotten dev processes (node, python, ruby, java, go run
+binaries and similar) of the current user, or of --user: processes orphaned
+to init, processes that leave a zombie child behind, and listeners without
+any connection that are older than --idle. They are listed with their age,
+memory and reason and killed after confirmation. --name replaces the list of
+dev processes and --cmdline narrows it; both can also be set in kill.yaml:
+
+  stale:
+    processes: [node, "python3*", java]
+    idle: 2h
+
+Use --dry-run to see what would be killed. devtool refuses to kill protected
+processes -- system services such as sshd and systemd, the Docker daemon and
+docker-proxy, and the shell devtool runs in -- unless --force is given. More
+names or globs can be protected in kill.yaml in the devtool config directory
+(for example ~/.config/devtool/kill.yaml):
+
+  protected:
+    - postgres
+    - "redis-*"
+
+Killing a protected process or a process owned by another user (including
+root) always asks for confirmation; without a terminal it needs --yes.
+
+With --output json the result for every process (PID, name, signal sent,
+whether it exited, elapsed time and error) is printed as JSON on stdout and
+progress messages go to stderr. The exit status tells scripts what happened:
+
+  0  everything selected was killed (or signalled)
+  1  other errors, including refusing protected processes
+  2  nothing matched, e.g. no process listens on the port
+  3  permission denied while signalling a process
+  4  a process is still running after SIGKILL`,
+	Example: `  devtool kill
+  devtool kill --pid 1234
+  devtool kill --port 8080
+  devtool kill --port 3000-3010 --port 8080,9090
+  devtool kill --name node --user $USER
+  devtool kill --cmdline 'vite|webpack serve' --yes
+  devtool kill --stale
+  devtool kill --stale --idle 30m --name node --dry-run
+  devtool kill --port 5432 --container service
+  devtool kill --port 3000 --parent
+  devtool kill --pid 1234 --tree
+  devtool kill --name 'python*' --dry-run
+  devtool kill --port 5432 --grace 30s
+  devtool kill --port 3000 --signal INT
+  devtool kill --pid 1234 --signal KILL
+  devtool kill --port 3000 --output json || [ $? -eq 2 ]`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if killPid == 0 && killPort == 0 {
-			fmt.Println("Error: must specify either --pid or --port")
-			_ = cmd.Help()
+		if killOutput != "text" && killOutput != "json" {
+			fmt.Printf("Invalid output format %q. Must be one of: text, json\n", killOutput)
 			os.Exit(1)
 		}
+		if killOutput == "json" {
+			killLog = os.Stderr
+		}
 
-		if killPid != 0 && killPort != 0 {
-			fmt.Println("Error: cannot specify both --pid and --port")
+		sig, err := parseSignal(killSignal)
+		if err != nil {
+			fmt.Fprintf(killLog, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if !validContainerAction(killContainer) {
+			fmt.Fprintf(killLog, "Invalid container action %q. Must be one of: %s\n", killContainer, strings.Join(containerKillActions, ", "))
 			os.Exit(1)
 		}
 
-		var targetPid int32
-		if killPid != 0 {
-			targetPid = killPid
-		} else {
-			// Find PID by port
-			fmt.Printf("Finding process on port %d...\n", killPort)
-			connections, err := net.Connections("inet")
+		config, err := loadKillConfig()
+		if err != nil {
+			fmt.Fprintf(killLog, "Error reading kill config: %v\n", err)
+			os.Exit(1)
+		}
+
+		selection := killSelection{PIDs: killPids, Names: killNames, User: killUser, Tree: killTree, Parent: killParent}
+		if killStale {
+			selection.Stale = true
+			selection.StaleNames = devProcessNames(config)
+			if len(killNames) > 0 {
+				selection.StaleNames = killNames
+			}
+			selection.StaleIdle = killIdle
+			if !cmd.Flags().Changed("idle") && config.Stale.Idle != "" {
+				selection.StaleIdle, err = time.ParseDuration(config.Stale.Idle)
+				if err != nil {
+					fmt.Fprintf(killLog, "Error reading kill config: invalid stale.idle: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if selection.User == "" {
+				selection.User = currentUsername()
+			}
+		}
+		interactive := len(killPids) == 0 && len(killPorts) == 0 && len(killNames) == 0 && killCmdline == "" && !killStale
+		if interactive {
+			if !stdinIsTerminal() || !stdoutIsTerminal() {
+				fmt.Fprintln(killLog, "Error: must specify --pid, --port, --name or --cmdline")
+				_ = cmd.Help()
+				os.Exit(1)
+			}
+			selection.PIDs, err = pickKillTargets(killUser)
 			if err != nil {
-				fmt.Printf("Error fetching connections: %v\n", err)
+				fmt.Fprintf(killLog, "Error: %v\n", err)
 				os.Exit(1)
 			}
-
-			found := false
-			for _, conn := range connections {
-				if conn.Status == "LISTEN" && int(conn.Laddr.Port) == killPort {
-					targetPid = conn.Pid
-					// There might be multiple connections (e.g. IPv4 and IPv6), but usually same PID.
-					// We take the first one we find.
-					found = true
-					break
-				}
+			if len(selection.PIDs) == 0 {
+				fmt.Fprintln(killLog, "Aborted.")
+				return
 			}
-
-			if !found {
-				fmt.Printf("No process found listening on port %d\n", killPort)
+		}
+		if len(killPorts) > 0 {
+			selection.Ports, err = parsePortList(strings.Join(killPorts, ","))
+			if err != nil {
+				fmt.Fprintf(killLog, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(killLog, "Finding processes on port %s...\n", strings.Join(killPorts, ","))
+		}
+		if killCmdline != "" {
+			selection.Cmdline, err = regexp.Compile(killCmdline)
+			if err != nil {
+				fmt.Fprintf(killLog, "Error: invalid --cmdline pattern: %v\n", err)
 				os.Exit(1)
 			}
 		}
 
-		// Kill the process
-		proc, err := process.NewProcess(targetPid)
+		targets, err := selection.find()
 		if err != nil {
-			fmt.Printf("Error finding process %d: %v\n", targetPid, err)
+			fmt.Fprintf(killLog, "Error: %v\n", err)
 			os.Exit(1)
 		}
+		if len(targets) == 0 {
+			if len(selection.Ports) == 1 && len(killPids) == 0 && len(killNames) == 0 && killCmdline == "" {
+				fmt.Fprintf(killLog, "No process found listening on port %d\n", selection.Ports[0])
+			} else if killStale {
+				fmt.Fprintln(killLog, "No stale dev processes found.")
+			} else {
+				fmt.Fprintln(killLog, "No matching processes found.")
+			}
+			writeKillReports(nil)
+			os.Exit(killExitNotFound)
+		}
 
-		name, _ := proc.Name()
-		fmt.Printf("Killing process %d (%s)...\n", targetPid, name)
+		var ports []int
+		for _, target := range targets {
+			ports = append(ports, target.Ports...)
+		}
 
-		err = proc.Kill()
-		if err != nil {
-			fmt.Printf("Error killing process: %v\n", err)
+		askContainer := !cmd.Flags().Changed("container") && !killYes && !killDryRun && stdinIsTerminal()
+		targets, containers, ok := splitContainerTargets(targets, killContainer, askContainer)
+		if !ok {
+			fmt.Fprintln(killLog, "Aborted.")
+			writeKillReports(refusedReports(targets, nil, "aborted"))
+			return
+		}
+
+		ancestors := selfAndAncestors()
+		currentUser := currentUsername()
+		var protected, foreign []killTarget
+		var reasons []string
+		protectedReasons := make(map[int32]string)
+		for _, target := range targets {
+			if reason := protectedReason(target, config, ancestors); reason != "" {
+				protected = append(protected, target)
+				reasons = append(reasons, reason)
+				protectedReasons[target.PID] = "protected: " + reason
+			}
+			if currentUser != "" && target.User != "" && target.User != currentUser {
+				foreign = append(foreign, target)
+			}
+		}
+
+		if len(targets) > 0 && (len(targets) > 1 || len(killNames) > 0 || killCmdline != "" || killTree || killParent || interactive || killStale || killDryRun || len(protected) > 0 || len(foreign) > 0) {
+			printKillTargets(targets)
+			fmt.Fprintln(killLog)
+		}
+		for i, target := range protected {
+			fmt.Fprintf(killLog, "Process %d (%s) is protected: %s.\n", target.PID, target.Name, reasons[i])
+		}
+		if len(protected) > 0 && !killForce {
+			fmt.Fprintln(killLog, "Refusing to kill protected processes. Use --force to kill them anyway.")
+			writeKillReports(refusedReports(targets, protectedReasons, "not killed: protected processes were selected"))
 			os.Exit(1)
 		}
+		for _, target := range foreign {
+			fmt.Fprintf(killLog, "Process %d (%s) belongs to %s.\n", target.PID, target.Name, target.User)
+		}
+
+		if killDryRun {
+			var reports []killReport
+			for _, action := range containers {
+				fmt.Fprintf(killLog, "Dry run: would %s.\n", action.describe())
+				reports = append(reports, killReport{Container: containerLabel(action.Container), Action: action.Action, DryRun: true})
+			}
+			for _, target := range targets {
+				reports = append(reports, killReport{PID: target.PID, Name: target.Name, User: target.User, Ports: target.Ports, Signal: signalName(sig), DryRun: true})
+			}
+			if len(targets) > 0 {
+				plan := fmt.Sprintf("send %s to %d process(es)", signalName(sig), len(targets))
+				if escalates(sig) {
+					plan += fmt.Sprintf(", escalating to SIGKILL after %s", killGrace)
+				}
+				fmt.Fprintf(killLog, "Dry run: would %s.\n", plan)
+			}
+			writeKillReports(reports)
+			return
+		}
+
+		if len(targets) > 0 && (len(targets) > 1 || interactive || killStale || len(protected) > 0 || len(foreign) > 0) && !killYes {
+			if stdinIsTerminal() {
+				question := fmt.Sprintf("Kill these %d processes?", len(targets))
+				if len(targets) == 1 {
+					question = fmt.Sprintf("Kill process %d (%s)?", targets[0].PID, targets[0].Name)
+				}
+				if !confirm(question) {
+					fmt.Fprintln(killLog, "Aborted.")
+					writeKillReports(refusedReports(targets, nil, "aborted"))
+					return
+				}
+			} else if len(protected) > 0 || len(foreign) > 0 || killStale {
+				fmt.Fprintln(killLog, "Error: not killing protected, stale or other users' processes without confirmation. Use --yes to confirm.")
+				writeKillReports(refusedReports(targets, nil, "not confirmed; use --yes"))
+				os.Exit(1)
+			}
+		}
 
-		fmt.Println("Process killed successfully.")
+		var reports []killReport
+		for _, action := range containers {
+			started := time.Now()
+			err := action.run(killGrace)
+			report := killReport{Container: containerLabel(action.Container), Action: action.Action, Exited: err == nil, ElapsedMS: time.Since(started).Milliseconds()}
+			if err != nil {
+				fmt.Fprintf(killLog, "Error: %v\n", err)
+				report.Error = err.Error()
+			}
+			reports = append(reports, report)
+		}
+		results := terminateProcesses(targets, sig, killGrace)
+		for _, result := range results {
+			reports = append(reports, result.report())
+		}
+
+		sort.Ints(ports)
+		for i, port := range ports {
+			if i == 0 || ports[i-1] != port {
+				verifyPortReleased(port)
+			}
+		}
+
+		writeKillReports(reports)
+		if code := killExitCode(reports, results); code != 0 {
+			os.Exit(code)
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(killCmd)
 
-	killCmd.Flags().Int32Var(&killPid, "pid", 0, "Process ID to kill")
-	killCmd.Flags().IntVar(&killPort, "port", 0, "Port number to find process and kill")
+	killCmd.Flags().Int32SliceVar(&killPids, "pid", nil, "Process ID to kill (repeatable or comma separated)")
+	killCmd.Flags().StringSliceVar(&killPorts, "port", nil, "Port or port range whose listeners to kill, e.g. 8080, 3000-3010 or 8080,9090")
+	killCmd.Flags().StringSliceVar(&killNames, "name", nil, "Process name or glob to kill, e.g. node or python*")
+	killCmd.Flags().StringVar(&killCmdline, "cmdline", "", "Regular expression matched against the full command line")
+	killCmd.Flags().StringVar(&killUser, "user", "", "Only kill processes owned by this user")
+	killCmd.Flags().StringVarP(&killSignal, "signal", "s", "TERM", "Signal to send, e.g. TERM, INT, HUP, KILL or 15")
+	killCmd.Flags().DurationVarP(&killGrace, "grace", "g", 5*time.Second, "How long to wait for the process to exit before sending SIGKILL")
+	killCmd.Flags().BoolVar(&killTree, "tree", false, "Also kill all descendants of each process, children first")
+	killCmd.Flags().BoolVar(&killParent, "parent", false, "Kill the dev tool that launched the process (npm, air, nodemon, ...) and all its children")
+	killCmd.Flags().BoolVar(&killStale, "stale", false, "Find forgotten dev processes: orphaned, leaving zombies, or listening idle for longer than --idle")
+	killCmd.Flags().DurationVar(&killIdle, "idle", time.Hour, "With --stale, how old a listener without connections must be to count as idle")
+	killCmd.Flags().StringVar(&killContainer, "container", "stop", "What to do when a port belongs to a container: stop, rm, service (stop the compose service) or process (kill the process anyway)")
+	killCmd.Flags().BoolVar(&killDryRun, "dry-run", false, "Show what would be killed without sending any signal")
+	killCmd.Flags().BoolVar(&killForce, "force", false, "Allow killing protected processes (system services, the Docker daemon, your shell)")
+	killCmd.Flags().StringVarP(&killOutput, "output", "o", "text", "Output format: text or json (progress messages then go to stderr)")
+	killCmd.Flags().BoolVarP(&killYes, "yes", "y", false, "Do not ask for confirmation before killing")
+}
+
+// parseSignal accepts a signal name with or without the SIG prefix, in any
+// case, or its number.
+func parseSignal(name string) (syscall.Signal, error) {
+	upper := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "SIG")
+	if sig, ok := killSignals[upper]; ok {
+		return sig, nil
+	}
+	if number, err := strconv.Atoi(upper); err == nil {
+		for _, sig := range killSignals {
+			if int(sig) == number {
+				return sig, nil
+			}
+		}
+	}
+
+	var names []string
+	for known := range killSignals {
+		names = append(names, known)
+	}
+	sort.Strings(names)
+	return 0, fmt.Errorf("unknown signal %q, expected one of: %s", name, strings.Join(names, ", "))
+}
+
+func signalName(sig syscall.Signal) string {
+	for name, known := range killSignals {
+		if known == sig {
+			return "SIG" + name
+		}
+	}
+	return fmt.Sprintf("signal %d", int(sig))
+}
+
+// escalates reports whether sig asks the process to exit, so that a process
+// still running after the grace period should be killed.
+func escalates(sig syscall.Signal) bool {
+	return sig == syscall.SIGTERM || sig == syscall.SIGINT || sig == killSignals["QUIT"]
+}
+
+// killResult records how a kill target ended up.
+type killResult struct {
+	Target  killTarget
+	Signal  syscall.Signal
+	Exited  bool
+	Elapsed time.Duration
+	Err     error
+}
+
+// terminateProcesses sends sig to every target and, for termination
+// signals, waits up to grace for them to exit before escalating the
+// remaining ones to SIGKILL. Each step is reported as it happens.
+func terminateProcesses(targets []killTarget, sig syscall.Signal, grace time.Duration) []killResult {
+	results := make([]killResult, len(targets))
+	procs := make([]*process.Process, len(targets))
+	started := time.Now()
+	var pending []int
+	for i, target := range targets {
+		results[i] = killResult{Target: target, Signal: sig}
+		fmt.Fprintf(killLog, "Sending %s to process %d (%s)...\n", signalName(sig), target.PID, target.Name)
+		proc, err := process.NewProcess(target.PID)
+		if err == nil {
+			err = sendSignal(proc, sig)
+		}
+		if processGone(err) {
+			// It exited on its own in the meantime, e.g. a shell whose child was signalled first.
+			results[i].Exited = true
+			fmt.Fprintf(killLog, "Process %d (%s) had already exited.\n", target.PID, target.Name)
+			continue
+		}
+		if err != nil {
+			results[i].Err = err
+			fmt.Fprintf(killLog, "Error signalling process %d: %v\n", target.PID, err)
+			continue
+		}
+		procs[i] = proc
+		pending = append(pending, i)
+	}
+
+	if sig != syscall.SIGKILL && !escalates(sig) {
+		if len(pending) > 0 {
+			fmt.Fprintln(killLog, "Signal sent.")
+		}
+		return results
+	}
+
+	finished := func(i int) {
+		results[i].Exited = true
+		results[i].Elapsed = time.Since(started)
+		target := results[i].Target
+		if results[i].Signal == syscall.SIGKILL && sig != syscall.SIGKILL {
+			fmt.Fprintf(killLog, "Process %d (%s) killed with SIGKILL (%s).\n", target.PID, target.Name, results[i].Elapsed.Round(time.Millisecond))
+		} else {
+			fmt.Fprintf(killLog, "Process %d (%s) exited after %s (%s).\n", target.PID, target.Name, signalName(sig), results[i].Elapsed.Round(time.Millisecond))
+		}
+	}
+
+	wait := grace
+	if sig == syscall.SIGKILL {
+		wait = 2 * time.Second
+	}
+	pending = waitForExits(procs, pending, wait, finished)
+
+	if sig != syscall.SIGKILL && len(pending) > 0 {
+		var escalated []int
+		for _, i := range pending {
+			target := results[i].Target
+			fmt.Fprintf(killLog, "Process %d (%s) still running after %s, sending SIGKILL...\n", target.PID, target.Name, grace)
+			err := sendSignal(procs[i], syscall.SIGKILL)
+			if processGone(err) {
+				// It exited just before SIGKILL went out.
+				finished(i)
+				continue
+			}
+			results[i].Signal = syscall.SIGKILL
+			if err != nil {
+				results[i].Err = err
+				fmt.Fprintf(killLog, "Error signalling process %d: %v\n", target.PID, err)
+				continue
+			}
+			escalated = append(escalated, i)
+		}
+		pending = waitForExits(procs, escalated, 2*time.Second, finished)
+	}
+
+	for _, i := range pending {
+		results[i].Elapsed = time.Since(started)
+		results[i].Err = fmt.Errorf("process %d is %w", results[i].Target.PID, errStillRunning)
+		fmt.Fprintf(killLog, "Error: %v\n", results[i].Err)
+	}
+	return results
+}
+
+// processGone reports whether signalling failed because the process had
+// already exited. os.Process.Signal reports that as os.ErrProcessDone.
+func processGone(err error) bool {
+	return errors.Is(err, os.ErrProcessDone) || errors.Is(err, process.ErrorProcessNotRunning) || errors.Is(err, syscall.ESRCH)
+}
+
+// errStillRunning marks processes that survived SIGKILL.
+var errStillRunning = errors.New("still running after SIGKILL")
+
+// killReport is one entry of the --output json result: a process, or a
+// container stopped in its place.
+type killReport struct {
+	PID       int32  `json:"pid,omitempty"`
+	Name      string `json:"name,omitempty"`
+	User      string `json:"user,omitempty"`
+	Ports     []int  `json:"ports,omitempty"`
+	Container string `json:"container,omitempty"`
+	Action    string `json:"action,omitempty"`
+	Signal    string `json:"signal,omitempty"`
+	Exited    bool   `json:"exited"`
+	ElapsedMS int64  `json:"elapsed_ms"`
+	DryRun    bool   `json:"dry_run,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (r killResult) report() killReport {
+	report := killReport{
+		PID:       r.Target.PID,
+		Name:      r.Target.Name,
+		User:      r.Target.User,
+		Ports:     r.Target.Ports,
+		Signal:    signalName(r.Signal),
+		Exited:    r.Exited,
+		ElapsedMS: r.Elapsed.Milliseconds(),
+	}
+	if r.Err != nil {
+		report.Error = r.Err.Error()
+	}
+	return report
+}
+
+// writeKillReports prints the results as JSON when --output json is set.
+func writeKillReports(reports []killReport) {
+	if killOutput != "json" {
+		return
+	}
+	if reports == nil {
+		reports = []killReport{}
+	}
+	payload, _ := json.MarshalIndent(reports, "", "  ")
+	fmt.Println(string(payload))
+}
+
+// refusedReports describes targets that were not signalled. reasons
+// overrides message for individual PIDs.
+func refusedReports(targets []killTarget, reasons map[int32]string, message string) []killReport {
+	reports := make([]killReport, 0, len(targets))
+	for _, target := range targets {
+		reason := message
+		if specific, ok := reasons[target.PID]; ok {
+			reason = specific
+		}
+		reports = append(reports, killReport{PID: target.PID, Name: target.Name, User: target.User, Ports: target.Ports, Error: reason})
+	}
+	return reports
+}
+
+// killExitCode picks the exit status for a run: permission errors first,
+// then processes that would not die, then any other failure.
+func killExitCode(reports []killReport, results []killResult) int {
+	code := 0
+	for _, result := range results {
+		switch {
+		case result.Err == nil:
+		case errors.Is(result.Err, os.ErrPermission):
+			return killExitPermission
+		case errors.Is(result.Err, errStillRunning):
+			code = killExitStillRunning
+		case code == 0:
+			code = 1
+		}
+	}
+	for _, report := range reports {
+		if report.Error != "" && code == 0 {
+			code = 1
+		}
+	}
+	return code
+}
+
+// waitForExits polls the processes at the pending indexes until each one is
+// gone or timeout passes, calling exited for every process that goes away,
+// and returns the indexes still running.
+func waitForExits(procs []*process.Process, pending []int, timeout time.Duration, exited func(int)) []int {
+	deadline := time.Now().Add(timeout)
+	for {
+		var running []int
+		for _, i := range pending {
+			if processExited(procs[i]) {
+				exited(i)
+			} else {
+				running = append(running, i)
+			}
+		}
+		pending = running
+		if len(pending) == 0 || !time.Now().Before(deadline) {
+			return pending
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func processExited(proc *process.Process) bool {
+	running, err := proc.IsRunning()
+	if err != nil || !running {
+		return true
+	}
+	status, err := proc.Status()
+	return err == nil && len(status) > 0 && status[0] == process.Zombie
+}
+
+// verifyPortReleased checks that nothing listens on port any more. Sockets
+// can linger for a moment after the owner exits, and a supervisor may have
+// restarted the server, so both cases are reported.
+func verifyPortReleased(port int) {
+	var holders []portRecord
+	for attempt := 0; attempt < 10; attempt++ {
+		holders, _ = collectPortRecords(func(conn net.ConnectionStat) bool {
+			return isListener(conn) && int(conn.Laddr.Port) == port
+		})
+		if len(holders) == 0 {
+			fmt.Fprintf(killLog, "Port %d is free.\n", port)
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	fmt.Fprintf(killLog, "Warning: port %d is still in use by %s\n", port, describeListeners(holders))
 }
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// containerKillActions are the accepted values of --container.
+var containerKillActions = []string{"stop", "rm", "service", "process"}
+
+func validContainerAction(action string) bool {
+	for _, known := range containerKillActions {
+		if action == known {
+			return true
+		}
+	}
+	return false
+}
+
+// containerAction stops or removes a container, or every container of its
+// compose service, in place of killing the process that holds its port.
+type containerAction struct {
+	Container *containerInfo
+	Action    string
+}
+
+// splitContainerTargets takes the targets whose ports belong to containers
+// out of targets and turns them into container actions: action, or the
+// user's answer when ask is set. Targets whose container cannot be reached
+// through an engine API, or for which "process" was chosen, stay process
+// targets. It returns false when the user cancelled.
+func splitContainerTargets(targets []killTarget, action string, ask bool) ([]killTarget, []containerAction, bool) {
+	var remaining []killTarget
+	var actions []containerAction
+	seen := make(map[string]bool)
+	for _, target := range targets {
+		var reachable []*containerInfo
+		for _, container := range target.Containers {
+			if container.engine.address == "" {
+				fmt.Fprintf(killLog, "Process %d (%s) belongs to container %s, but no Docker or Podman API is reachable.\n", target.PID, target.Name, container.ID)
+				continue
+			}
+			reachable = append(reachable, container)
+		}
+		if len(reachable) == 0 {
+			remaining = append(remaining, target)
+			continue
+		}
+
+		var names []string
+		for _, container := range reachable {
+			names = append(names, containerLabel(container))
+		}
+		relation := "runs in"
+		if isContainerProxy(target.Name) {
+			relation = "forwards ports for"
+		}
+		fmt.Fprintf(killLog, "Process %d (%s) %s container %s.\n", target.PID, target.Name, relation, strings.Join(names, ", "))
+
+		choice := action
+		if ask {
+			choice = askContainerAction()
+			if choice == "" {
+				return nil, nil, false
+			}
+		}
+		if choice == "process" {
+			remaining = append(remaining, target)
+			continue
+		}
+		for _, container := range reachable {
+			if !seen[container.ID] {
+				seen[container.ID] = true
+				actions = append(actions, containerAction{Container: container, Action: choice})
+			}
+		}
+	}
+	return remaining, actions, true
+}
+
+func askContainerAction() string {
+	fmt.Fprint(killLog, "[s]top the container, [r]emove it, stop its compose s[e]rvice, [k]ill the process anyway or [c]ancel? [s] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "", "s", "stop":
+		return "stop"
+	case "r", "rm", "remove":
+		return "rm"
+	case "e", "service":
+		return "service"
+	case "k", "kill", "process":
+		return "process"
+	}
+	return ""
+}
+
+// describe says what run will do, for --dry-run.
+func (a containerAction) describe() string {
+	switch {
+	case a.Action == "rm":
+		return "stop and remove container " + containerLabel(a.Container)
+	case a.Action == "service" && a.Container.ComposeService != "":
+		return fmt.Sprintf("stop all containers of compose service %s/%s", a.Container.ComposeProject, a.Container.ComposeService)
+	}
+	return "stop container " + containerLabel(a.Container)
+}
+
+// run carries out the action, giving containers grace to stop before the
+// engine kills them.
+func (a containerAction) run(grace time.Duration) error {
+	engine := a.Container.engine
+	if a.Action == "service" {
+		if a.Container.ComposeService == "" {
+			fmt.Fprintf(killLog, "Container %s is not part of a compose service, stopping only the container.\n", containerLabel(a.Container))
+			return stopContainer(engine, a.Container, grace)
+		}
+		containers, err := engine.containers()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(killLog, "Stopping compose service %s/%s...\n", a.Container.ComposeProject, a.Container.ComposeService)
+		for _, container := range containers {
+			info := newContainerInfo(container)
+			if info.ComposeProject == a.Container.ComposeProject && info.ComposeService == a.Container.ComposeService {
+				if err := stopContainer(engine, info, grace); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := stopContainer(engine, a.Container, grace); err != nil {
+		return err
+	}
+	if a.Action == "rm" {
+		fmt.Fprintf(killLog, "Removing container %s...\n", containerLabel(a.Container))
+		if err := engine.removeContainer(a.Container.ID); err != nil {
+			return err
+		}
+		fmt.Fprintln(killLog, "Container removed.")
+	}
+	return nil
+}
+
+func stopContainer(engine engineEndpoint, container *containerInfo, grace time.Duration) error {
+	fmt.Fprintf(killLog, "Stopping %s container %s...\n", engine.runtime, containerLabel(container))
+	started := time.Now()
+	if err := engine.stopContainer(container.ID, grace); err != nil {
+		return err
+	}
+	fmt.Fprintf(killLog, "Container %s stopped (%s).\n", containerLabel(container), time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+// containerLabel names a container as "name (project/service)".
+func containerLabel(container *containerInfo) string {
+	name := container.Name
+	if name == "" {
+		name = container.ID
+	}
+	if container.ComposeService != "" {
+		name += " (" + container.ComposeProject + "/" + container.ComposeService + ")"
+	}
+	return name
+}
+
+// stopContainer asks the engine to stop a container, sending SIGKILL after
+// grace (rounded up to whole seconds, as the API expects).
+func (e engineEndpoint) stopContainer(id string, grace time.Duration) error {
+	seconds := int(math.Ceil(grace.Seconds()))
+	client := e.client(time.Duration(seconds)*time.Second + 30*time.Second)
+	response, err := client.Post(fmt.Sprintf("http://engine/containers/%s/stop?t=%d", id, seconds), "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	// 304 means the container had already stopped.
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusNotModified {
+		return e.apiError(response)
+	}
+	return nil
+}
+
+func (e engineEndpoint) removeContainer(id string) error {
+	request, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://engine/containers/%s?force=true", id), nil)
+	if err != nil {
+		return err
+	}
+	response, err := e.client(30 * time.Second).Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK {
+		return e.apiError(response)
+	}
+	return nil
+}
+
+// apiError turns an engine error response, {"message": "..."}, into an error.
+func (e engineEndpoint) apiError(response *http.Response) error {
+	var body struct {
+		Message string `json:"message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+	if json.Unmarshal(data, &body) == nil && body.Message != "" {
+		return fmt.Errorf("%s API: %s", e.runtime, body.Message)
+	}
+	return fmt.Errorf("%s API returned %s", e.runtime, response.Status)
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// defaultProtectedNames are system and container services that devtool
+// refuses to kill without --force. Entries are names or globs, compared
+// case-insensitively.
+var defaultProtectedNames = []string{
+	"init", "systemd", "systemd-*", "launchd", "kernel_task",
+	"sshd", "dbus-daemon", "polkitd", "NetworkManager",
+	"dockerd", "docker-proxy", "containerd", "containerd-shim*", "com.docker.*", "vpnkit",
+	"podman", "conmon", "kubelet",
+	"Xorg", "Xwayland", "gnome-shell", "WindowServer", "loginwindow",
+	"csrss.exe", "wininit.exe", "winlogon.exe", "services.exe", "lsass.exe", "svchost.exe", "explorer.exe",
+}
+
+// killConfig is read from kill.yaml in the devtool config directory:
+//
+//	protected:
+//	  - postgres
+//	  - "redis-*"
+//	stale:
+//	  processes: [node, "python3*", java]
+//	  idle: 2h
+type killConfig struct {
+	Protected []string `yaml:"protected"`
+	Stale     struct {
+		Processes []string `yaml:"processes"`
+		Idle      string   `yaml:"idle"`
+	} `yaml:"stale"`
+}
+
+func killConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "devtool", "kill.yaml"), nil
+}
+
+// loadKillConfig reads kill.yaml; a missing file is an empty config.
+func loadKillConfig() (*killConfig, error) {
+	config := &killConfig{}
+	path, err := killConfigPath()
+	if err != nil {
+		return config, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return config, nil
+}
+
+// protectedReason explains why target must not be killed without --force,
+// or returns "" when it may be.
+func protectedReason(target killTarget, config *killConfig, ancestors map[int32]bool) string {
+	switch {
+	case target.PID <= 1:
+		return "system init process"
+	case ancestors[target.PID]:
+		return "runs devtool (your shell or one of its parents)"
+	case matchesAnyName(defaultProtectedNames, target.Name):
+		return "system or container service"
+	case matchesAnyName(config.Protected, target.Name):
+		return "listed as protected in kill.yaml"
+	}
+	return ""
+}
+
+// currentUsername is the user devtool runs as, or "" if unknown.
+func currentUsername() string {
+	current, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return current.Username
+}
@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// pickerItem is one row of the interactive kill picker.
+type pickerItem struct {
+	target   killTarget
+	line     string
+	search   string
+	selected bool
+}
+
+// pickKillTargets lets the user choose listening processes on the terminal
+// with a fuzzy filter. It returns the chosen PIDs, or nil when cancelled.
+func pickKillTargets(user string) ([]int32, error) {
+	records, err := listeningRecords()
+	if err != nil {
+		return nil, fmt.Errorf("fetching connections: %v", err)
+	}
+
+	self := int32(os.Getpid())
+	byPID := make(map[int32]*killTarget)
+	var targets []*killTarget
+	for _, record := range records {
+		if record.PID == self || record.lookupErr != nil || (user != "" && record.User != user) {
+			continue
+		}
+		target := byPID[record.PID]
+		if target == nil {
+			target = newKillTarget(record)
+			byPID[record.PID] = target
+			targets = append(targets, target)
+		}
+		target.addPort(int(record.Port))
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no listening processes found")
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Ports[0] < targets[j].Ports[0] })
+
+	// Align all rows once so columns do not jump around while filtering.
+	var table bytes.Buffer
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PID\tNAME\tPORTS\tUSER\tMEMORY\tCOMMAND")
+	for _, target := range targets {
+		var ports []string
+		for _, port := range target.Ports {
+			ports = append(ports, strconv.Itoa(port))
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%.1f MB\t%s\n", target.PID, target.Name, strings.Join(ports, ","), target.User, float64(target.RSS)/1024/1024, strings.Join(strings.Fields(target.Cmdline), " "))
+	}
+	w.Flush()
+	lines := strings.Split(strings.TrimRight(table.String(), "\n"), "\n")
+
+	items := make([]*pickerItem, len(targets))
+	for i, target := range targets {
+		items[i] = &pickerItem{target: *target, line: lines[i+1], search: strings.ToLower(lines[i+1])}
+	}
+
+	restore, err := makeTerminalRaw()
+	if err != nil {
+		return nil, fmt.Errorf("the interactive picker is unavailable (%v), use --pid, --port, --name or --cmdline", err)
+	}
+	defer restore()
+
+	width, height := terminalSize()
+	picker := &killPicker{items: items, header: lines[0], width: width, height: height}
+	return picker.run()
+}
+
+type killPicker struct {
+	items   []*pickerItem
+	header  string
+	query   []rune
+	visible []*pickerItem
+	cursor  int
+	offset  int
+	width   int
+	height  int
+}
+
+func (p *killPicker) run() ([]int32, error) {
+	p.filter()
+	buffer := make([]byte, 64)
+	for {
+		p.draw()
+		n, err := os.Stdin.Read(buffer)
+		if err != nil {
+			return nil, err
+		}
+		key := string(buffer[:n])
+		switch {
+		case key == "\x1b" || key == "\x03" || key == "\x04":
+			p.clear()
+			return nil, nil
+		case key == "\r" || key == "\n":
+			p.clear()
+			return p.chosen(), nil
+		case key == "\t":
+			if p.cursor < len(p.visible) {
+				p.visible[p.cursor].selected = !p.visible[p.cursor].selected
+				p.move(1)
+			}
+		case key == "\x1b[A" || key == "\x1bOA" || key == "\x10":
+			p.move(-1)
+		case key == "\x1b[B" || key == "\x1bOB" || key == "\x0e":
+			p.move(1)
+		case key == "\x7f" || key == "\x08":
+			if len(p.query) > 0 {
+				p.query = p.query[:len(p.query)-1]
+				p.filter()
+			}
+		case key == "\x15":
+			p.query = nil
+			p.filter()
+		case key[0] >= ' ' && key[0] != 0x7f && utf8.ValidString(key):
+			p.query = append(p.query, []rune(key)...)
+			p.filter()
+		}
+	}
+}
+
+// chosen returns the selected rows, or the row under the cursor when
+// nothing was selected.
+func (p *killPicker) chosen() []int32 {
+	var pids []int32
+	for _, item := range p.items {
+		if item.selected {
+			pids = append(pids, item.target.PID)
+		}
+	}
+	if len(pids) == 0 && p.cursor < len(p.visible) {
+		pids = append(pids, p.visible[p.cursor].target.PID)
+	}
+	return pids
+}
+
+func (p *killPicker) move(delta int) {
+	p.cursor += delta
+	if p.cursor >= len(p.visible) {
+		p.cursor = len(p.visible) - 1
+	}
+	if p.cursor < 0 {
+		p.cursor = 0
+	}
+}
+
+// filter keeps the rows that fuzzy-match the query, best matches first.
+func (p *killPicker) filter() {
+	query := strings.ToLower(string(p.query))
+	type scored struct {
+		item  *pickerItem
+		score int
+	}
+	var matches []scored
+	for _, item := range p.items {
+		if score, ok := fuzzyScore(query, item.search); ok {
+			matches = append(matches, scored{item, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score < matches[j].score })
+
+	p.visible = p.visible[:0]
+	for _, match := range matches {
+		p.visible = append(p.visible, match.item)
+	}
+	p.cursor, p.offset = 0, 0
+}
+
+// fuzzyScore reports whether the runes of query appear in text in order.
+// The score counts the characters skipped between matched runes, so that
+// tighter matches sort first.
+func fuzzyScore(query, text string) (int, bool) {
+	if query == "" {
+		return 0, true
+	}
+	if index := strings.Index(text, query); index >= 0 {
+		return 0, true
+	}
+	score, last := 0, -1
+	remaining := []rune(query)
+	for i, r := range []rune(text) {
+		if len(remaining) == 0 {
+			break
+		}
+		if r != remaining[0] {
+			continue
+		}
+		if last >= 0 {
+			score += i - last - 1
+		}
+		last = i
+		remaining = remaining[1:]
+	}
+	return score + 1, len(remaining) == 0
+}
+
+func (p *killPicker) draw() {
+	rows := p.height - 4
+	if rows < 1 {
+		rows = 1
+	}
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	}
+	if p.cursor >= p.offset+rows {
+		p.offset = p.cursor - rows + 1
+	}
+
+	var screen strings.Builder
+	screen.WriteString("\033[H\033[2J")
+	screen.WriteString(p.fit(fmt.Sprintf("Kill> %s", string(p.query))) + "\r\n")
+	screen.WriteString("\033[2m" + p.fit(fmt.Sprintf("%d/%d  Tab select, Enter kill, Esc cancel", len(p.visible), len(p.items))) + "\033[0m\r\n")
+	screen.WriteString(p.fit("    "+p.header) + "\r\n")
+	for i := p.offset; i < len(p.visible) && i < p.offset+rows; i++ {
+		item := p.visible[i]
+		pointer, mark := "  ", "  "
+		if i == p.cursor {
+			pointer = "> "
+		}
+		if item.selected {
+			mark = "* "
+		}
+		line := p.fit(pointer + mark + item.line)
+		if i == p.cursor {
+			line = "\033[7m" + line + "\033[0m"
+		}
+		screen.WriteString(line + "\r\n")
+	}
+	// Leave the cursor at the end of the query.
+	screen.WriteString(fmt.Sprintf("\033[1;%dH", utf8.RuneCountInString("Kill> "+string(p.query))+1))
+	os.Stdout.WriteString(screen.String())
+}
+
+func (p *killPicker) clear() {
+	os.Stdout.WriteString("\033[H\033[2J")
+}
+
+// fit truncates a line to the terminal width.
+func (p *killPicker) fit(line string) string {
+	if runes := []rune(line); len(runes) > p.width {
+		return string(runes[:p.width])
+	}
+	return line
+}
@@ -0,0 +1,52 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// makeTerminalRaw switches the terminal to raw mode with stty and returns a
+// function restoring the previous settings.
+func makeTerminalRaw() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() {
+		stty(strings.TrimSpace(saved))
+	}, nil
+}
+
+// terminalSize returns the terminal's columns and rows, or 80x24.
+func terminalSize() (int, int) {
+	size, err := stty("size")
+	if fields := strings.Fields(size); err == nil && len(fields) == 2 {
+		rows, rowsErr := strconv.Atoi(fields[0])
+		columns, columnsErr := strconv.Atoi(fields[1])
+		if rowsErr == nil && columnsErr == nil && rows > 0 && columns > 0 {
+			return columns, rows
+		}
+	}
+	return 80, 24
+}
+
+func stty(args ...string) (string, error) {
+	command := exec.Command("stty", args...)
+	command.Stdin = os.Stdin
+	output, err := command.Output()
+	return string(output), err
+}
+
+// notifyResize sends on ch whenever the terminal window is resized.
+func notifyResize(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGWINCH)
+}
@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+)
+
+func makeTerminalRaw() (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported on Windows")
+}
+
+func terminalSize() (int, int) {
+	return 80, 24
+}
+
+// notifyResize is a no-op; Windows consoles are not resized through signals.
+func notifyResize(ch chan<- os.Signal) {}
@@ -0,0 +1,26 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"syscall"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// killSignals are the signals accepted by --signal.
+var killSignals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"TERM": syscall.SIGTERM,
+	"STOP": syscall.SIGSTOP,
+	"CONT": syscall.SIGCONT,
+}
+
+func sendSignal(proc *process.Process, sig syscall.Signal) error {
+	return proc.SendSignal(sig)
+}
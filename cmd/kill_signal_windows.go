@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"syscall"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// killSignals are the signals accepted by --signal. Windows has no signals
+// to deliver, so every one of them terminates the process.
+var killSignals = map[string]syscall.Signal{
+	"INT":  syscall.SIGINT,
+	"KILL": syscall.SIGKILL,
+	"TERM": syscall.SIGTERM,
+}
+
+func sendSignal(proc *process.Process, sig syscall.Signal) error {
+	if sig == syscall.SIGKILL {
+		return proc.Kill()
+	}
+	return proc.Terminate()
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	psnet "github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// defaultDevProcesses are the runtimes and tools --stale looks at. They can
+// be replaced with stale.processes in kill.yaml or with --name.
+var defaultDevProcesses = []string{
+	"node", "nodejs", "deno", "bun", "npm", "npx", "yarn", "pnpm", "next-server*",
+	"vite", "esbuild", "webpack*", "nodemon", "ts-node", "tsx",
+	"python", "python2*", "python3*", "uvicorn", "gunicorn", "flask", "celery",
+	"ruby", "rails", "puma", "rake", "bundle",
+	"java", "gradle*", "mvn", "go", "air", "dlv", "cargo",
+	"php", "dotnet", "beam.smp", "mix",
+}
+
+// devProcessNames is the dev process list from kill.yaml, or the default.
+func devProcessNames(config *killConfig) []string {
+	if len(config.Stale.Processes) > 0 {
+		return config.Stale.Processes
+	}
+	return defaultDevProcesses
+}
+
+// findStale returns the dev processes that look forgotten, with the reason:
+// orphaned (re-parented to init or a user session manager), leaving a zombie
+// child behind, or listening with no connections and older than idle. Since
+// connection history is not available, "idle" means no established
+// connections right now.
+func (s killSelection) findStale() (map[int32]string, error) {
+	connections, err := psnet.Connections("inet")
+	if err != nil {
+		return nil, fmt.Errorf("fetching connections: %v", err)
+	}
+	listening := make(map[int32]bool)
+	active := make(map[int32]bool)
+	for _, conn := range connections {
+		if isListener(conn) {
+			listening[conn.Pid] = true
+		} else if conn.Status == "ESTABLISHED" {
+			active[conn.Pid] = true
+		}
+	}
+
+	processes, err := process.Processes()
+	if err != nil {
+		return nil, fmt.Errorf("listing processes: %v", err)
+	}
+	reasons := make(map[int32][]string)
+	var order []int32
+	addReason := func(pid int32, reason string) {
+		if reasons[pid] == nil {
+			order = append(order, pid)
+		}
+		reasons[pid] = append(reasons[pid], reason)
+	}
+
+	for _, proc := range processes {
+		if !isDevProcess(proc, s.StaleNames) {
+			continue
+		}
+		if s.Cmdline != nil {
+			if cmdline, err := proc.Cmdline(); err != nil || !s.Cmdline.MatchString(cmdline) {
+				continue
+			}
+		}
+		name, _ := proc.Name()
+
+		if status, err := proc.Status(); err == nil && len(status) > 0 && status[0] == process.Zombie {
+			// A zombie is already dead; only its parent can clear it.
+			if parent, err := proc.Parent(); err == nil && parent.Pid > 1 && isDevProcess(parent, s.StaleNames) {
+				addReason(parent.Pid, fmt.Sprintf("zombie child %d", proc.Pid))
+			} else {
+				fmt.Fprintf(killLog, "Zombie process %d (%s) cannot be killed; its parent has to reap it.\n", proc.Pid, name)
+			}
+			continue
+		}
+
+		if isOrphaned(proc) {
+			addReason(proc.Pid, "orphaned")
+		}
+		if listening[proc.Pid] && !active[proc.Pid] {
+			if created, err := proc.CreateTime(); err == nil {
+				if age := time.Since(time.UnixMilli(created)); age >= s.StaleIdle {
+					addReason(proc.Pid, "idle listener for "+formatAge(age))
+				}
+			}
+		}
+	}
+
+	stale := make(map[int32]string, len(order))
+	for _, pid := range order {
+		stale[pid] = strings.Join(reasons[pid], ", ")
+	}
+	return stale, nil
+}
+
+// isDevProcess matches the process name, the first command line word and
+// binaries built by "go run" against names.
+func isDevProcess(proc *process.Process, names []string) bool {
+	if name, err := proc.Name(); err == nil && matchesAnyName(names, name) {
+		return true
+	}
+	if args, err := proc.CmdlineSlice(); err == nil && len(args) > 0 && matchesAnyName(names, executableName(args[0])) {
+		return true
+	}
+	exe, _ := proc.Exe()
+	return strings.Contains(filepath.ToSlash(exe), "/go-build")
+}
+
+// isOrphaned reports whether the process lost the parent that started it
+// and was adopted by init or a systemd user manager acting as subreaper.
+func isOrphaned(proc *process.Process) bool {
+	parent, err := proc.Parent()
+	if err != nil || parent == nil {
+		return false
+	}
+	if parent.Pid == 1 {
+		return true
+	}
+	name, _ := parent.Name()
+	cmdline, _ := parent.Cmdline()
+	return name == "systemd" && strings.Contains(cmdline, "--user")
+}
+
+// formatAge renders a duration as its two largest units, e.g. 3d4h or 12m.
+func formatAge(age time.Duration) string {
+	switch {
+	case age >= 24*time.Hour:
+		return fmt.Sprintf("%dd%dh", int(age.Hours())/24, int(age.Hours())%24)
+	case age >= time.Hour:
+		return fmt.Sprintf("%dh%dm", int(age.Hours()), int(age.Minutes())%60)
+	case age >= time.Minute:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	}
+	return fmt.Sprintf("%ds", int(age.Seconds()))
+}
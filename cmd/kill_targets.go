@@ -0,0 +1,275 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// killTarget is one process selected for killing, with the ports it
+// listens on and the containers behind the ports it was selected by.
+type killTarget struct {
+	PID        int32
+	Name       string
+	User       string
+	Cmdline    string
+	RSS        uint64
+	StartTime  *time.Time
+	Ports      []int
+	Containers []*containerInfo
+	Reason     string
+}
+
+// killSelection holds the kill criteria. PIDs, ports and the name/cmdline
+// match each add processes; User then narrows the whole set down. Tree and
+// Parent widen it again to whole process trees (see expand). With Stale the
+// name/cmdline match is replaced by the stale dev process search, which
+// looks for StaleNames and narrows by Cmdline.
+type killSelection struct {
+	PIDs       []int32
+	Ports      []int
+	Names      []string
+	Cmdline    *regexp.Regexp
+	User       string
+	Tree       bool
+	Parent     bool
+	Stale      bool
+	StaleNames []string
+	StaleIdle  time.Duration
+}
+
+func newKillTarget(record portRecord) *killTarget {
+	return &killTarget{
+		PID:       record.PID,
+		Name:      record.Name,
+		User:      record.User,
+		Cmdline:   record.Cmdline,
+		RSS:       record.RSS,
+		StartTime: record.StartTime,
+	}
+}
+
+func (t *killTarget) addContainer(container *containerInfo) {
+	for _, existing := range t.Containers {
+		if existing.ID == container.ID {
+			return
+		}
+	}
+	t.Containers = append(t.Containers, container)
+}
+
+func (t *killTarget) addPort(port int) {
+	for _, existing := range t.Ports {
+		if existing == port {
+			return
+		}
+	}
+	t.Ports = append(t.Ports, port)
+	sort.Ints(t.Ports)
+}
+
+// find resolves the selection to processes, sorted by PID unless process
+// trees were requested. devtool itself is never selected, and name and
+// command line patterns never match its ancestors, such as the shell whose
+// command line contains the pattern.
+func (s killSelection) find() ([]killTarget, error) {
+	listeners, err := collectPortRecords(isListener)
+	if err != nil {
+		return nil, fmt.Errorf("fetching connections: %v", err)
+	}
+
+	targets := make(map[int32]*killTarget)
+	self := int32(os.Getpid())
+	add := func(record portRecord) {
+		if record.PID == self || targets[record.PID] != nil {
+			return
+		}
+		targets[record.PID] = newKillTarget(record)
+	}
+
+	for _, pid := range s.PIDs {
+		record := processRecord(pid)
+		if record.lookupErr != nil {
+			fmt.Fprintf(killLog, "No process with PID %d: %v\n", pid, record.lookupErr)
+			continue
+		}
+		add(record)
+	}
+
+	wanted := make(map[int]bool, len(s.Ports))
+	for _, port := range s.Ports {
+		wanted[port] = true
+	}
+	for _, record := range listeners {
+		if wanted[int(record.Port)] && record.lookupErr == nil {
+			add(record)
+			if target := targets[record.PID]; target != nil && record.Container != nil {
+				target.addContainer(record.Container)
+			}
+		}
+	}
+
+	if s.Stale {
+		stale, err := s.findStale()
+		if err != nil {
+			return nil, err
+		}
+		ancestors := selfAndAncestors()
+		for pid, reason := range stale {
+			if ancestors[pid] {
+				continue
+			}
+			if record := processRecord(pid); record.lookupErr == nil {
+				add(record)
+				if target := targets[pid]; target != nil {
+					target.Reason = reason
+				}
+			}
+		}
+	} else if len(s.Names) > 0 || s.Cmdline != nil {
+		processes, err := process.Processes()
+		if err != nil {
+			return nil, fmt.Errorf("listing processes: %v", err)
+		}
+		ancestors := selfAndAncestors()
+		for _, proc := range processes {
+			if ancestors[proc.Pid] || targets[proc.Pid] != nil || !s.matchesProcess(proc) {
+				continue
+			}
+			if record := processRecord(proc.Pid); record.lookupErr == nil {
+				add(record)
+			}
+		}
+	}
+
+	var selected []killTarget
+	for _, target := range targets {
+		if s.User != "" && target.User != s.User {
+			continue
+		}
+		selected = append(selected, *target)
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].PID < selected[j].PID })
+	if s.Tree || s.Parent {
+		selected = s.expand(selected)
+	}
+
+	for i := range selected {
+		for _, record := range listeners {
+			if record.PID == selected[i].PID {
+				selected[i].addPort(int(record.Port))
+			}
+		}
+	}
+	return selected, nil
+}
+
+// matchesProcess applies --name (exact or glob, case-insensitive) and
+// --cmdline (regular expression); when both are given both must match.
+func (s killSelection) matchesProcess(proc *process.Process) bool {
+	if len(s.Names) > 0 {
+		name, err := proc.Name()
+		if err != nil || !matchesAnyName(s.Names, name) {
+			return false
+		}
+	}
+	if s.Cmdline != nil {
+		cmdline, err := proc.Cmdline()
+		if err != nil || !s.Cmdline.MatchString(cmdline) {
+			return false
+		}
+	}
+	return true
+}
+
+func selfAndAncestors() map[int32]bool {
+	pids := map[int32]bool{int32(os.Getpid()): true}
+	proc, err := process.NewProcess(int32(os.Getpid()))
+	if err != nil {
+		return pids
+	}
+	for parent, err := proc.Parent(); err == nil && parent != nil && !pids[parent.Pid]; parent, err = parent.Parent() {
+		pids[parent.Pid] = true
+	}
+	return pids
+}
+
+func matchesAnyName(patterns []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if pattern == name {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// printKillTargets shows what is about to be killed. Age and reason columns
+// are added for stale processes.
+func printKillTargets(targets []killTarget) {
+	withReason := false
+	for _, target := range targets {
+		if target.Reason != "" {
+			withReason = true
+		}
+	}
+
+	w := tabwriter.NewWriter(killLog, 0, 0, 3, ' ', 0)
+	if withReason {
+		fmt.Fprintln(w, "PID\tNAME\tUSER\tAGE\tPORTS\tMEMORY\tREASON\tCOMMAND")
+	} else {
+		fmt.Fprintln(w, "PID\tNAME\tUSER\tPORTS\tMEMORY\tCOMMAND")
+	}
+	for _, target := range targets {
+		ports := "-"
+		if len(target.Ports) > 0 {
+			var list []string
+			for _, port := range target.Ports {
+				list = append(list, strconv.Itoa(port))
+			}
+			ports = strings.Join(list, ",")
+		}
+		command := []rune(strings.Join(strings.Fields(target.Cmdline), " "))
+		if len(command) > 60 {
+			command = append(command[:57], []rune("...")...)
+		}
+		memory := fmt.Sprintf("%.1f MB", float64(target.RSS)/1024/1024)
+		if withReason {
+			age := "-"
+			if target.StartTime != nil {
+				age = formatAge(time.Since(*target.StartTime))
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", target.PID, target.Name, target.User, age, ports, memory, target.Reason, string(command))
+		} else {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", target.PID, target.Name, target.User, ports, memory, string(command))
+		}
+	}
+	w.Flush()
+}
+
+// confirm asks a yes/no question on the terminal; anything but y or yes
+// declines.
+func confirm(question string) bool {
+	fmt.Fprintf(killLog, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func stdinIsTerminal() bool {
+	stat, err := os.Stdin.Stat()
+	return err == nil && (stat.Mode()&os.ModeCharDevice) != 0
+}
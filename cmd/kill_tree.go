@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// launcherNames are dev tools that start and supervise servers. Killing
+// only their child usually makes them restart it.
+var launcherNames = map[string]bool{
+	"npm": true, "npx": true, "yarn": true, "pnpm": true, "bun": true,
+	"nodemon": true, "ts-node-dev": true, "tsx": true, "concurrently": true,
+	"turbo": true, "nx": true, "pm2": true,
+	"air": true, "reflex": true, "gow": true, "modd": true, "realize": true, "go": true,
+	"watchexec": true, "entr": true, "cargo-watch": true, "cargo": true,
+	"foreman": true, "overmind": true, "honcho": true,
+	"dotnet": true, "mix": true,
+}
+
+// shellNames are shells that package managers put between themselves and
+// the server they run, as in npm's "sh -c next dev".
+var shellNames = map[string]bool{"sh": true, "bash": true, "dash": true, "zsh": true, "ash": true, "cmd": true}
+
+// expand applies --parent and --tree to the selected processes. --parent
+// swaps each process for the dev tool that launched it, and both add all
+// descendants, ordered so that children are signalled before their parents.
+// devtool and its ancestors are never added.
+func (s killSelection) expand(roots []killTarget) []killTarget {
+	protected := selfAndAncestors()
+	known := make(map[int32]killTarget, len(roots))
+	seen := make(map[int32]bool)
+	var order []int32
+	visit := func(pid int32) {
+		if !seen[pid] && !protected[pid] {
+			seen[pid] = true
+			order = append(order, pid)
+		}
+	}
+
+	for _, root := range roots {
+		known[root.PID] = root
+		pid := root.PID
+		if s.Parent {
+			if launcher := findLauncher(pid, protected); launcher != nil {
+				fmt.Fprintf(killLog, "Process %d (%s) was started by %s (%d); killing the launcher and its children instead.\n", root.PID, root.Name, launcher.Name, launcher.PID)
+				pid = launcher.PID
+			} else {
+				fmt.Fprintf(killLog, "No dev tool launched process %d (%s); killing it and its children.\n", root.PID, root.Name)
+			}
+		}
+		for _, child := range descendants(pid) {
+			visit(child)
+		}
+		visit(pid)
+	}
+
+	var expanded []killTarget
+	for _, pid := range order {
+		if target, ok := known[pid]; ok {
+			expanded = append(expanded, target)
+			continue
+		}
+		if record := processRecord(pid); record.lookupErr == nil {
+			expanded = append(expanded, *newKillTarget(record))
+		}
+	}
+	return expanded
+}
+
+// descendants returns every process below pid, deepest first.
+func descendants(pid int32) []int32 {
+	var pids []int32
+	seen := map[int32]bool{pid: true}
+	var walk func(proc *process.Process)
+	walk = func(proc *process.Process) {
+		children, err := proc.Children()
+		if err != nil {
+			return
+		}
+		for _, child := range children {
+			if seen[child.Pid] {
+				continue
+			}
+			seen[child.Pid] = true
+			walk(child)
+			pids = append(pids, child.Pid)
+		}
+	}
+	if proc, err := process.NewProcess(pid); err == nil {
+		walk(proc)
+	}
+	return pids
+}
+
+// findLauncher walks up from pid through launchers and the shells they
+// start, and returns the topmost launcher, or nil when the process was not
+// started by one.
+func findLauncher(pid int32, protected map[int32]bool) *processRef {
+	proc, err := process.NewProcess(pid)
+	if err != nil {
+		return nil
+	}
+	var launcher *processRef
+	seen := map[int32]bool{pid: true}
+	for parent, err := proc.Parent(); err == nil && parent != nil; parent, err = parent.Parent() {
+		if parent.Pid <= 1 || seen[parent.Pid] || protected[parent.Pid] {
+			break
+		}
+		seen[parent.Pid] = true
+		ref := newProcessRef(parent)
+		if isLauncher(ref) {
+			launcher = &ref
+			continue
+		}
+		if !isShellWrapper(ref) {
+			break
+		}
+	}
+	return launcher
+}
+
+// isLauncher checks the process name and the first two command line words,
+// so that "node /usr/bin/nodemon app.js" and "npm run dev" are recognised.
+func isLauncher(ref processRef) bool {
+	candidates := strings.Fields(ref.Name)
+	if len(candidates) > 1 {
+		candidates = candidates[:1]
+	}
+	args := strings.Fields(ref.Cmdline)
+	if len(args) > 2 {
+		args = args[:2]
+	}
+	for _, candidate := range append(candidates, args...) {
+		if launcherNames[executableName(candidate)] {
+			return true
+		}
+	}
+	return false
+}
+
+func isShellWrapper(ref processRef) bool {
+	args := strings.Fields(ref.Cmdline)
+	if !shellNames[executableName(ref.Name)] || len(args) < 2 {
+		return false
+	}
+	return args[1] == "-c" || strings.EqualFold(args[1], "/c")
+}
+
+func executableName(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	return strings.TrimSuffix(name, ".exe")
+}
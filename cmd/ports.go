@@ -2,10 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"text/tabwriter"
 	"time"
 
@@ -16,24 +18,55 @@ import (
 
 var filter string
 var showPath bool
+var portsOutput string
+var portsWatch bool
+var portsWatchInterval time.Duration
+var portsWatchEvents bool
+var portsWatchExec string
+var portsConnections bool
+var portsProtocol string
+var portsShowEnv bool
 
 var portsCmd = &cobra.Command{
 	Use:     "ports [port]",
 	Aliases: []string{"port"},
 	Short:   "Lists all process listening on ports or detailed info for a specific port",
 	Long: `Lists all processes that are listening on ports.
-By default, shows PID, Name, and Port.
+By default, shows PID, Name, Protocol, Bind Address and Port for TCP listeners and UDP sockets.
+A bind address of 0.0.0.0 or :: means the port is reachable on every network interface.
 
 If a port number is provided, shows detailed information about the process listening on that port,
-including PID, User, Memory usage, Start Time, and full Command Line.
+including PID, User, Memory usage, Start Time, full Command Line, working directory, open file count,
+the process tree from the root down to the listener's children, and the listener's other sockets.
+Add --env to include its environment variables, with secret-looking values redacted.
 
 Use --show-path (or -p) to include the executable path in the list view.
-Use --filter (or -f) to filter by process name in the list view.`,
+Use --filter (or -f) to filter by process name in the list view.
+Use --protocol to limit results to tcp, tcp6, udp or udp6 sockets.
+Use --connections (or -c) to list established connections with their remote endpoints.
+Use --output (or -o) json, csv or yaml to emit full records for scripts.
+Use --watch (or -w) to keep refreshing the list and highlight ports as they open and close.`,
 	Example: `  devtool ports
   devtool ports --filter chrome
   devtool ports --show-path
-  devtool port 8080`,
+  devtool ports --protocol udp
+  devtool ports --connections
+  devtool ports --output json
+  devtool ports --watch --interval 1s
+  devtool ports --watch --events --exec 'echo $DEVTOOL_EVENT $DEVTOOL_PORT'
+  devtool port 8080
+  devtool port 8080 --env
+  devtool port 8080 --output yaml`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if !validPortsOutput(portsOutput) {
+			fmt.Printf("Invalid output format %q. Must be one of: table, json, csv, yaml\n", portsOutput)
+			os.Exit(1)
+		}
+		if !validPortsProtocol(portsProtocol) {
+			fmt.Printf("Invalid protocol %q. Must be one of: tcp, tcp6, udp, udp6\n", portsProtocol)
+			os.Exit(1)
+		}
+
 		// Specific port details mode
 		if len(args) > 0 {
 			portStr := args[0]
@@ -43,120 +76,95 @@ Use --filter (or -f) to filter by process name in the list view.`,
 				return
 			}
 
-			connections, err := net.Connections("inet")
+			records, err := collectPortRecords(func(conn net.ConnectionStat) bool {
+				return isListener(conn) && int(conn.Laddr.Port) == port && matchesProtocol(socketProtocol(conn))
+			})
 			if err != nil {
 				fmt.Printf("Error fetching connections: %v\n", err)
 				return
 			}
 
-			found := false
-			for _, conn := range connections {
-				if conn.Status == "LISTEN" && int(conn.Laddr.Port) == port {
-					found = true
-					pid := conn.Pid
-					proc, err := process.NewProcess(pid)
-					if err != nil {
-						fmt.Printf("Error accessing process info for PID %d: %v\n", pid, err)
-						return
-					}
-
-					name, _ := proc.Name()
-					exe, _ := proc.Exe()
-					user, _ := proc.Username()
-					status, _ := proc.Status() // returns []string, needs handling
-					mem, _ := proc.MemoryInfo()
-					createTime, _ := proc.CreateTime() // ms since epoch
-					cmdline, _ := proc.Cmdline()
-
-					// Format start time
-					startTime := time.Unix(createTime/1000, 0)
-					timeStr := startTime.Format(time.RFC1123)
-
-					// Format Memory
-					rss := uint64(0)
-					if mem != nil {
-						rss = mem.RSS
-					}
-					rssMB := float64(rss) / 1024 / 1024
-
-					// Safe status string (Status() returns []string, usually single element like "S", "R")
-					statusStr := strings.Join(status, ",")
-
-					// Docker Detection
-					isDockerProxy := strings.Contains(name, "com.docker.backend") ||
-						strings.Contains(name, "vpnkit") ||
-						strings.Contains(name, "docker-proxy")
-
-					var dockerInfo string
-					if isDockerProxy {
-						dockerContainer, err := findDockerContainer(port)
-						if err == nil && dockerContainer != "" {
-							dockerInfo = dockerContainer
-						}
-					}
-
-					fmt.Printf("Port:        %d\n", port)
-					fmt.Printf("PID:         %d\n", pid)
-					fmt.Printf("Process:     %s\n", name)
-					fmt.Printf("Path:        %s\n", exe)
-					fmt.Printf("User:        %s\n", user)
-					fmt.Printf("Status:      %s\n", statusStr)
-					fmt.Printf("Memory(RSS): %.2f MB\n", rssMB)
-					fmt.Printf("Start Time:  %s\n", timeStr)
-					fmt.Printf("Command:     %s\n", cmdline)
-
-					if dockerInfo != "" {
-						fmt.Printf("\nDocker Container Details:\n%s\n", dockerInfo)
-					}
-					return // Stop after finding the first listener on this port (usually one per proto/interface)
+			contexts := make(map[int32]*processContext)
+			for i := range records {
+				if records[i].lookupErr != nil {
+					continue
+				}
+				if _, ok := contexts[records[i].PID]; !ok {
+					contexts[records[i].PID] = inspectProcessContext(records[i].PID, portsShowEnv)
 				}
+				records[i].Context = contexts[records[i].PID]
+			}
+
+			if portsOutput != "table" {
+				if err := writePortRecords(os.Stdout, records, portsOutput); err != nil {
+					fmt.Printf("Error writing output: %v\n", err)
+					os.Exit(1)
+				}
+				return
 			}
 
-			if !found {
+			if len(records) == 0 {
 				fmt.Printf("No process found listening on port %d\n", port)
+				return
+			}
+
+			// Show the first listener on this port (usually one per proto/interface)
+			if records[0].lookupErr != nil {
+				fmt.Printf("Error accessing process info for PID %d: %v\n", records[0].PID, records[0].lookupErr)
+				return
+			}
+			printPortDetails(records[0], records)
+			return
+		}
+
+		if portsConnections {
+			records, err := connectionRecords()
+			if err != nil {
+				fmt.Printf("Error fetching connections: %v\n", err)
+				return
 			}
+
+			if portsOutput != "table" {
+				if err := writePortRecords(os.Stdout, records, portsOutput); err != nil {
+					fmt.Printf("Error writing output: %v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
+
+			writeConnectionsTable(os.Stdout, records)
+			return
+		}
+
+		if portsWatch {
+			if portsOutput != "table" && portsOutput != "json" {
+				fmt.Println("--watch supports only table or json output")
+				os.Exit(1)
+			}
+			if portsWatchInterval < 100*time.Millisecond {
+				fmt.Println("Error: --interval must be at least 100ms")
+				os.Exit(1)
+			}
+			watchPorts()
 			return
 		}
 
 		// Existing "list all" mode
-		connections, err := net.Connections("inet")
+		records, err := listeningRecords()
 		if err != nil {
 			fmt.Printf("Error fetching connections: %v\n", err)
 			return
 		}
 
-		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-		if showPath {
-			fmt.Fprintln(w, "PID\tNAME\tPORT\tPATH")
-		} else {
-			fmt.Fprintln(w, "PID\tNAME\tPORT")
-		}
-
-		for _, conn := range connections {
-			if conn.Status == "LISTEN" {
-				pid := conn.Pid
-				proc, err := process.NewProcess(pid)
-				name := "UNKNOWN"
-				path := "UNKNOWN"
-				if err == nil {
-					name, _ = proc.Name()
-					if showPath {
-						path, _ = proc.Exe()
-					}
-				}
-
-				if filter != "" && !strings.Contains(strings.ToLower(name), strings.ToLower(filter)) {
-					continue
-				}
-
-				if showPath {
-					fmt.Fprintf(w, "%d\t%s\t%d\t%s\n", pid, name, conn.Laddr.Port, path)
-				} else {
-					fmt.Fprintf(w, "%d\t%s\t%d\n", pid, name, conn.Laddr.Port)
-				}
+		if portsOutput != "table" {
+			if err := writePortRecords(os.Stdout, records, portsOutput); err != nil {
+				fmt.Printf("Error writing output: %v\n", err)
+				os.Exit(1)
 			}
+			return
 		}
-		w.Flush()
+
+		writePortsTable(os.Stdout, records)
 	},
 }
 
@@ -164,42 +172,346 @@ func init() {
 	rootCmd.AddCommand(portsCmd)
 	portsCmd.Flags().StringVarP(&filter, "filter", "f", "", "Filter by process name (case-insensitive)")
 	portsCmd.Flags().BoolVarP(&showPath, "show-path", "p", false, "Show executable path")
+	portsCmd.Flags().StringVarP(&portsOutput, "output", "o", "table", "Output format: table, json, csv or yaml")
+	portsCmd.Flags().BoolVarP(&portsWatch, "watch", "w", false, "Refresh the listener list until interrupted")
+	portsCmd.Flags().DurationVar(&portsWatchInterval, "interval", 2*time.Second, "Refresh interval for --watch")
+	portsCmd.Flags().BoolVar(&portsWatchEvents, "events", false, "With --watch, print one line per opened or closed port instead of redrawing")
+	portsCmd.Flags().StringVar(&portsWatchExec, "exec", "", "With --watch, shell command to run for every opened or closed port")
+	portsCmd.Flags().BoolVarP(&portsConnections, "connections", "c", false, "List established connections instead of listeners")
+	portsCmd.Flags().BoolVar(&portsShowEnv, "env", false, "Include the process environment in the port detail view (secrets redacted)")
+	portsCmd.Flags().StringVar(&portsProtocol, "protocol", "", "Only show tcp, tcp6, udp or udp6 sockets (tcp and udp include IPv6)")
+}
+
+// isListener reports whether a socket accepts incoming traffic: a TCP
+// socket in LISTEN state or a UDP socket with no fixed remote peer.
+func isListener(conn net.ConnectionStat) bool {
+	if conn.Type == syscall.SOCK_DGRAM {
+		return conn.Raddr.Port == 0
+	}
+	return conn.Status == "LISTEN"
+}
+
+func validPortsProtocol(protocol string) bool {
+	switch protocol {
+	case "", "tcp", "tcp6", "udp", "udp6":
+		return true
+	}
+	return false
+}
+
+// matchesProtocol applies --protocol; "tcp" and "udp" also match their
+// IPv6 variants.
+func matchesProtocol(protocol string) bool {
+	return portsProtocol == "" || protocol == portsProtocol || strings.TrimSuffix(protocol, "6") == portsProtocol
+}
+
+func matchesFilter(record portRecord) bool {
+	return filter == "" || strings.Contains(strings.ToLower(record.Name), strings.ToLower(filter))
+}
+
+// listeningRecords returns every listening socket, narrowed by --filter
+// and --protocol and ordered by port.
+func listeningRecords() ([]portRecord, error) {
+	return filteredRecords(isListener)
+}
+
+// connectionRecords returns every socket with a remote peer, such as
+// established TCP connections and connected UDP sockets.
+func connectionRecords() ([]portRecord, error) {
+	return filteredRecords(func(conn net.ConnectionStat) bool {
+		if conn.Raddr.Port == 0 {
+			return false
+		}
+		return conn.Type == syscall.SOCK_DGRAM || conn.Status == "ESTABLISHED"
+	})
+}
+
+func filteredRecords(match func(conn net.ConnectionStat) bool) ([]portRecord, error) {
+	records, err := collectPortRecords(func(conn net.ConnectionStat) bool {
+		return match(conn) && matchesProtocol(socketProtocol(conn))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := records[:0]
+	for _, record := range records {
+		if matchesFilter(record) {
+			filtered = append(filtered, record)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		a, b := filtered[i], filtered[j]
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		if a.BindIP != b.BindIP {
+			return a.BindIP < b.BindIP
+		}
+		return a.RemoteAddress < b.RemoteAddress
+	})
+	return filtered, nil
+}
+
+// writePortsTable prints the listener table. A CONTAINER column is added
+// when any listener belongs to a container.
+func writePortsTable(out io.Writer, records []portRecord) {
+	showContainer := false
+	for _, record := range records {
+		if record.Container != nil {
+			showContainer = true
+			break
+		}
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	header := "PID\tNAME\tPROTO\tADDRESS\tPORT"
+	if showContainer {
+		header += "\tCONTAINER"
+	}
+	if showPath {
+		header += "\tPATH"
+	}
+	fmt.Fprintln(w, header)
+
+	for _, record := range records {
+		row := fmt.Sprintf("%d\t%s\t%s\t%s\t%d", record.PID, record.Name, record.Protocol, record.BindIP, record.Port)
+		if showContainer {
+			container := "-"
+			if record.Container != nil {
+				container = record.Container.describe()
+			}
+			row += "\t" + container
+		}
+		if showPath {
+			row += "\t" + record.Exe
+		}
+		fmt.Fprintln(w, row)
+	}
+	w.Flush()
 }
 
-// findDockerContainer tries to find which docker container is mapping the given port
-func findDockerContainer(port int) (string, error) {
-	// Look for docker in common paths if not in PATH
-	dockerCmd := "docker"
-	if _, err := os.Stat("/usr/local/bin/docker"); err == nil {
-		dockerCmd = "/usr/local/bin/docker"
+// writeConnectionsTable lists each connection followed by a per-process
+// count, busiest process first.
+func writeConnectionsTable(out io.Writer, records []portRecord) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	if showPath {
+		fmt.Fprintln(w, "PID\tNAME\tPROTO\tLOCAL\tREMOTE\tSTATUS\tPATH")
+	} else {
+		fmt.Fprintln(w, "PID\tNAME\tPROTO\tLOCAL\tREMOTE\tSTATUS")
+	}
+
+	type processCount struct {
+		pid   int32
+		name  string
+		count int
+	}
+	counts := make(map[int32]*processCount)
+	var order []*processCount
+
+	for _, record := range records {
+		state := record.SocketState
+		if state == "" || state == "NONE" {
+			state = "-"
+		}
+		if showPath {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", record.PID, record.Name, record.Protocol, record.LocalAddress, record.RemoteAddress, state, record.Exe)
+		} else {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", record.PID, record.Name, record.Protocol, record.LocalAddress, record.RemoteAddress, state)
+		}
+
+		count, ok := counts[record.PID]
+		if !ok {
+			count = &processCount{pid: record.PID, name: record.Name}
+			counts[record.PID] = count
+			order = append(order, count)
+		}
+		count.count++
 	}
-	// Add other common paths if needed
+	w.Flush()
+
+	if len(order) == 0 {
+		return
+	}
+	sort.SliceStable(order, func(i, j int) bool { return order[i].count > order[j].count })
+
+	fmt.Fprintln(out)
+	w = tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "PID\tNAME\tCONNECTIONS")
+	for _, count := range order {
+		fmt.Fprintf(w, "%d\t%s\t%d\n", count.pid, count.name, count.count)
+	}
+	w.Flush()
+}
 
-	cmd := exec.Command(dockerCmd, "ps", "--format", "{{.ID}}\t{{.Image}}\t{{.Names}}\t{{.Ports}}")
-	output, err := cmd.Output()
+// portRecord describes one socket and the process that owns it.
+type portRecord struct {
+	PID           int32          `json:"pid" yaml:"pid"`
+	Name          string         `json:"name" yaml:"name"`
+	Exe           string         `json:"exe" yaml:"exe"`
+	User          string         `json:"user" yaml:"user"`
+	Protocol      string         `json:"protocol" yaml:"protocol"`
+	LocalAddress  string         `json:"local_address" yaml:"local_address"`
+	BindIP        string         `json:"bind_ip" yaml:"bind_ip"`
+	Port          uint32         `json:"port" yaml:"port"`
+	RemoteAddress string         `json:"remote_address,omitempty" yaml:"remote_address,omitempty"`
+	SocketState   string         `json:"socket_state,omitempty" yaml:"socket_state,omitempty"`
+	Status        string         `json:"status" yaml:"status"`
+	RSS           uint64         `json:"rss_bytes" yaml:"rss_bytes"`
+	StartTime     *time.Time     `json:"start_time,omitempty" yaml:"start_time,omitempty"`
+	Cmdline       string         `json:"cmdline" yaml:"cmdline"`
+	Container     *containerInfo `json:"container,omitempty" yaml:"container,omitempty"`
+
+	// Context is only filled in for the single-port detail view.
+	Context *processContext `json:"process_context,omitempty" yaml:"process_context,omitempty"`
+
+	// lookupErr is set when the owning process could not be inspected.
+	lookupErr error
+}
+
+// collectPortRecords returns a record for every socket accepted by match,
+// with the owning process details filled in. Process lookups are cached,
+// so a process with many sockets is only inspected once.
+func collectPortRecords(match func(conn net.ConnectionStat) bool) ([]portRecord, error) {
+	connections, err := net.Connections("inet")
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		if strings.TrimSpace(line) == "" {
+	cache := make(map[int32]portRecord)
+	seen := make(map[string]bool)
+	var records []portRecord
+	for _, conn := range connections {
+		if !match(conn) {
 			continue
 		}
-		parts := strings.Split(line, "\t")
-		if len(parts) >= 4 {
-			id := parts[0]
-			image := parts[1]
-			name := parts[2]
-			ports := parts[3]
-
-			// Check if the specific port is mapped
-			// Format allows: 0.0.0.0:8080->80/tcp, ::1:8080->80/tcp
-			portStr := strconv.Itoa(port)
-			if strings.Contains(ports, ":"+portStr+"->") || strings.Contains(ports, ":"+portStr+",") {
-				return fmt.Sprintf("ID:      %s\nImage:   %s\nName:    %s", id, image, name), nil
+
+		// SO_REUSEPORT and forked workers can report the same socket
+		// several times for one process; keep a single row.
+		key := fmt.Sprintf("%d|%s|%s|%s", conn.Pid, socketProtocol(conn), formatSocketAddr(conn.Laddr), formatSocketAddr(conn.Raddr))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		record, ok := cache[conn.Pid]
+		if !ok {
+			record = processRecord(conn.Pid)
+			cache[conn.Pid] = record
+		}
+
+		record.Protocol = socketProtocol(conn)
+		record.BindIP = conn.Laddr.IP
+		record.Port = conn.Laddr.Port
+		record.LocalAddress = formatSocketAddr(conn.Laddr)
+		if conn.Raddr.Port != 0 {
+			record.RemoteAddress = formatSocketAddr(conn.Raddr)
+			record.SocketState = conn.Status
+		}
+
+		records = append(records, record)
+	}
+
+	resolveContainers(records)
+	return records, nil
+}
+
+// processRecord fills in the process fields of a portRecord. Processes that
+// cannot be inspected (for example owned by another user) are reported as
+// UNKNOWN rather than skipped.
+func processRecord(pid int32) portRecord {
+	record := portRecord{PID: pid, Name: "UNKNOWN", Exe: "UNKNOWN"}
+
+	proc, err := process.NewProcess(pid)
+	if err != nil {
+		record.lookupErr = err
+		return record
+	}
+
+	record.Name, _ = proc.Name()
+	record.Exe, _ = proc.Exe()
+	record.User, _ = proc.Username()
+	status, _ := proc.Status() // returns []string, usually single element like "S", "R"
+	record.Status = strings.Join(status, ",")
+	if mem, _ := proc.MemoryInfo(); mem != nil {
+		record.RSS = mem.RSS
+	}
+	if createTime, err := proc.CreateTime(); err == nil {
+		startTime := time.Unix(createTime/1000, 0)
+		record.StartTime = &startTime
+	}
+	record.Cmdline, _ = proc.Cmdline()
+
+	return record
+}
+
+func socketProtocol(conn net.ConnectionStat) string {
+	protocol := "tcp"
+	if conn.Type == syscall.SOCK_DGRAM {
+		protocol = "udp"
+	}
+	if conn.Family == syscall.AF_INET6 {
+		protocol += "6"
+	}
+	return protocol
+}
+
+func formatSocketAddr(addr net.Addr) string {
+	if strings.Contains(addr.IP, ":") {
+		return fmt.Sprintf("[%s]:%d", addr.IP, addr.Port)
+	}
+	return fmt.Sprintf("%s:%d", addr.IP, addr.Port)
+}
+
+// printPortDetails prints the process behind record, listing every
+// address in sockets that the same process listens on.
+func printPortDetails(record portRecord, sockets []portRecord) {
+	var addresses []string
+	for _, socket := range sockets {
+		if socket.PID == record.PID {
+			address := socket.Protocol + " " + socket.LocalAddress
+			if socket.BindIP == "0.0.0.0" || socket.BindIP == "::" {
+				address += " (all interfaces)"
 			}
+			addresses = append(addresses, address)
+		}
+	}
+
+	fmt.Printf("Port:        %d\n", record.Port)
+	fmt.Printf("Address:     %s\n", strings.Join(addresses, ", "))
+	fmt.Printf("PID:         %d\n", record.PID)
+	fmt.Printf("Process:     %s\n", record.Name)
+	fmt.Printf("Path:        %s\n", record.Exe)
+	fmt.Printf("User:        %s\n", record.User)
+	fmt.Printf("Status:      %s\n", record.Status)
+	fmt.Printf("Memory(RSS): %.2f MB\n", float64(record.RSS)/1024/1024)
+	var startTime string
+	if record.StartTime != nil {
+		startTime = record.StartTime.Format(time.RFC1123)
+	}
+	fmt.Printf("Start Time:  %s\n", startTime)
+	fmt.Printf("Command:     %s\n", record.Cmdline)
+	if record.Context != nil {
+		printProcessContext(record, record.Context)
+	}
+
+	if container := record.Container; container != nil {
+		fmt.Printf("\nContainer Details:\n")
+		if container.Runtime != "" {
+			fmt.Printf("Runtime: %s\n", container.Runtime)
+		}
+		fmt.Printf("ID:      %s\n", container.ID)
+		if container.Name != "" {
+			fmt.Printf("Name:    %s\nImage:   %s\n", container.Name, container.Image)
+		}
+		if container.ComposeProject != "" {
+			fmt.Printf("Compose: %s (service %s)\n", container.ComposeProject, container.ComposeService)
+		}
+		if container.ContainerPort != "" {
+			fmt.Printf("Mapping: %d -> %s\n", container.HostPort, container.ContainerPort)
 		}
 	}
-	return "", nil
 }
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var checkDir string
+var checkOutput string
+
+var portsCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check whether the ports a project needs are free",
+	Long: `Reads the ports a project declares and reports which ones are already in use,
+and by which process or container.
+
+Ports are collected from compose files (published ports, including
+${VAR:-default} references resolved from .env), .env files (*PORT* variables
+and ports in URLs), Procfiles and package.json scripts (--port 3000, -p 3000,
+PORT=3000, localhost:3000 and similar).
+
+Exits with status 1 when any declared port is occupied.`,
+	Example: `  devtool ports check
+  devtool ports check --dir ~/src/shop
+  devtool ports check --output json`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if checkOutput != "table" && checkOutput != "json" {
+			fmt.Printf("Invalid output format %q. Must be one of: table, json\n", checkOutput)
+			os.Exit(1)
+		}
+
+		declared, err := findProjectPorts(checkDir)
+		if err != nil {
+			fmt.Printf("Error reading project ports: %v\n", err)
+			os.Exit(1)
+		}
+		if len(declared) == 0 {
+			if checkOutput == "json" {
+				fmt.Println("[]")
+				return
+			}
+			fmt.Printf("No port declarations found in %s\n", checkDir)
+			return
+		}
+
+		records, err := collectPortRecords(isListener)
+		if err != nil {
+			fmt.Printf("Error fetching connections: %v\n", err)
+			os.Exit(1)
+		}
+		results := checkProjectPorts(declared, records)
+
+		conflicts := 0
+		for _, result := range results {
+			if result.InUse {
+				conflicts++
+			}
+		}
+
+		if checkOutput == "json" {
+			payload, _ := json.MarshalIndent(results, "", "  ")
+			fmt.Println(string(payload))
+		} else {
+			printPortCheck(results)
+			if conflicts > 0 {
+				fmt.Printf("\n%d of %d declared ports are already in use\n", conflicts, len(results))
+			} else {
+				fmt.Printf("\nAll %d declared ports are free\n", len(results))
+			}
+		}
+
+		if conflicts > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	portsCmd.AddCommand(portsCheckCmd)
+	portsCheckCmd.Flags().StringVarP(&checkDir, "dir", "d", ".", "Project directory to read")
+	portsCheckCmd.Flags().StringVarP(&checkOutput, "output", "o", "table", "Output format: table or json")
+}
+
+// portCheckResult is one declared port and whatever currently holds it.
+type portCheckResult struct {
+	Port         int           `json:"port"`
+	Declarations []projectPort `json:"declared_by"`
+	InUse        bool          `json:"in_use"`
+	Listeners    []portRecord  `json:"listeners,omitempty"`
+}
+
+// checkProjectPorts groups declarations by port and attaches the listeners
+// on each port. Only TCP listeners count, unless a declaration says udp.
+// declared must be sorted by port.
+func checkProjectPorts(declared []projectPort, records []portRecord) []portCheckResult {
+	listeners := make(map[int][]portRecord)
+	for _, record := range records {
+		listeners[int(record.Port)] = append(listeners[int(record.Port)], record)
+	}
+
+	var results []portCheckResult
+	for _, declaration := range declared {
+		if len(results) == 0 || results[len(results)-1].Port != declaration.Port {
+			results = append(results, portCheckResult{Port: declaration.Port})
+		}
+		last := &results[len(results)-1]
+		last.Declarations = append(last.Declarations, declaration)
+	}
+
+	for i := range results {
+		for _, record := range listeners[results[i].Port] {
+			if declaresProtocol(results[i].Declarations, record.Protocol) {
+				results[i].Listeners = append(results[i].Listeners, record)
+			}
+		}
+		results[i].InUse = len(results[i].Listeners) > 0
+	}
+	return results
+}
+
+// declaresProtocol reports whether any declaration is for the listener's
+// protocol ("tcp6" counts as "tcp").
+func declaresProtocol(declarations []projectPort, protocol string) bool {
+	for _, declaration := range declarations {
+		declared := declaration.Protocol
+		if declared == "" {
+			declared = "tcp"
+		}
+		if strings.HasPrefix(protocol, declared) {
+			return true
+		}
+	}
+	return false
+}
+
+func printPortCheck(results []portCheckResult) {
+	var table bytes.Buffer
+	w := tabwriter.NewWriter(&table, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "PORT\tSTATUS\tDECLARED BY\tUSED BY")
+	for _, result := range results {
+		var sources []string
+		for _, declaration := range result.Declarations {
+			name := declaration.Name
+			if declaration.Protocol != "" {
+				name += ", " + declaration.Protocol
+			}
+			sources = append(sources, fmt.Sprintf("%s (%s)", declaration.Source, name))
+		}
+
+		status, usedBy := "free", "-"
+		if result.InUse {
+			status = "in use"
+			usedBy = describeListeners(result.Listeners)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", result.Port, status, strings.Join(sources, ", "), usedBy)
+	}
+	w.Flush()
+
+	color := stdoutIsTerminal()
+	lines := strings.Split(strings.TrimRight(table.String(), "\n"), "\n")
+	fmt.Println(lines[0])
+	for i, line := range lines[1:] {
+		if color && results[i].InUse {
+			line = "\033[31m" + line + "\033[0m"
+		}
+		fmt.Println(line)
+	}
+}
+
+// describeListeners names the distinct processes, or containers, holding a port.
+func describeListeners(records []portRecord) string {
+	var names []string
+	seen := make(map[int32]bool)
+	for _, record := range records {
+		if seen[record.PID] {
+			continue
+		}
+		seen[record.PID] = true
+		name := fmt.Sprintf("%s (pid %d)", record.Name, record.PID)
+		if record.Container != nil {
+			name = "container " + record.Container.describe()
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
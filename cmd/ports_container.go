@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// containerInfo identifies the container behind a port.
+type containerInfo struct {
+	ID             string `json:"id" yaml:"id"`
+	Name           string `json:"name,omitempty" yaml:"name,omitempty"`
+	Image          string `json:"image,omitempty" yaml:"image,omitempty"`
+	Runtime        string `json:"runtime,omitempty" yaml:"runtime,omitempty"`
+	ComposeProject string `json:"compose_project,omitempty" yaml:"compose_project,omitempty"`
+	ComposeService string `json:"compose_service,omitempty" yaml:"compose_service,omitempty"`
+	HostPort       uint16 `json:"host_port,omitempty" yaml:"host_port,omitempty"`
+	ContainerPort  string `json:"container_port,omitempty" yaml:"container_port,omitempty"`
+
+	engine engineEndpoint
+}
+
+// engineContainer is the subset of GET /containers/json that we use. Docker
+// and Podman's compatibility API return the same shape.
+type engineContainer struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Image  string            `json:"Image"`
+	Labels map[string]string `json:"Labels"`
+	Ports  []struct {
+		IP          string `json:"IP"`
+		PrivatePort uint16 `json:"PrivatePort"`
+		PublicPort  uint16 `json:"PublicPort"`
+		Type        string `json:"Type"`
+	} `json:"Ports"`
+
+	engine engineEndpoint
+}
+
+// containerIDPattern finds a full container ID in a cgroup path such as
+// /docker/<id>, docker-<id>.scope or libpod-<id>.scope.
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// isContainerProxy reports whether a process forwards ports for containers.
+func isContainerProxy(name string) bool {
+	for _, proxy := range []string{"com.docker.backend", "vpnkit", "docker-proxy", "rootlessport", "conmon", "gvproxy", "slirp4netns", "pasta"} {
+		if strings.Contains(name, proxy) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveContainers attaches container details to records owned by a
+// container port proxy or by a process running inside a container. The
+// engine APIs are only queried when at least one record needs them.
+func resolveContainers(records []portRecord) {
+	cgroupIDs := make(map[int32]string)
+	needed := false
+	for _, record := range records {
+		if _, ok := cgroupIDs[record.PID]; !ok {
+			cgroupIDs[record.PID] = cgroupContainerID(record.PID)
+		}
+		if cgroupIDs[record.PID] != "" || isContainerProxy(record.Name) {
+			needed = true
+		}
+	}
+	if !needed {
+		return
+	}
+
+	containers := listEngineContainers()
+	for i := range records {
+		record := &records[i]
+		if id := cgroupIDs[record.PID]; id != "" {
+			record.Container = containerByID(containers, id, record.Port, record.Protocol)
+			continue
+		}
+		if isContainerProxy(record.Name) {
+			record.Container = containerByPublishedPort(containers, record.Port, record.Protocol)
+		}
+	}
+}
+
+// cgroupContainerID returns the container ID from /proc/<pid>/cgroup, or ""
+// when the process is not in a container or the file cannot be read.
+func cgroupContainerID(pid int32) string {
+	if pid <= 0 {
+		return ""
+	}
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return ""
+	}
+	return containerIDPattern.FindString(string(data))
+}
+
+func containerByID(containers []engineContainer, id string, port uint32, protocol string) *containerInfo {
+	for _, container := range containers {
+		if container.ID == id {
+			info := newContainerInfo(container)
+			// The process listens inside the container; show where the port is published, if anywhere.
+			for _, mapping := range container.Ports {
+				if uint32(mapping.PrivatePort) == port && mapping.Type == strings.TrimSuffix(protocol, "6") && mapping.PublicPort != 0 {
+					info.HostPort = mapping.PublicPort
+					info.ContainerPort = fmt.Sprintf("%d/%s", mapping.PrivatePort, mapping.Type)
+					break
+				}
+			}
+			return info
+		}
+	}
+	// No engine reachable (or the container is not running); the ID still tells the user where to look.
+	return &containerInfo{ID: shortContainerID(id)}
+}
+
+func containerByPublishedPort(containers []engineContainer, port uint32, protocol string) *containerInfo {
+	for _, container := range containers {
+		for _, mapping := range container.Ports {
+			if uint32(mapping.PublicPort) == port && mapping.Type == strings.TrimSuffix(protocol, "6") {
+				info := newContainerInfo(container)
+				info.HostPort = mapping.PublicPort
+				info.ContainerPort = fmt.Sprintf("%d/%s", mapping.PrivatePort, mapping.Type)
+				return info
+			}
+		}
+	}
+	return nil
+}
+
+func newContainerInfo(container engineContainer) *containerInfo {
+	info := &containerInfo{
+		ID:      shortContainerID(container.ID),
+		Image:   container.Image,
+		Runtime: container.engine.runtime,
+		engine:  container.engine,
+	}
+	if len(container.Names) > 0 {
+		info.Name = strings.TrimPrefix(container.Names[0], "/")
+	}
+	info.ComposeProject = container.Labels["com.docker.compose.project"]
+	info.ComposeService = container.Labels["com.docker.compose.service"]
+	if info.ComposeProject == "" {
+		info.ComposeProject = container.Labels["io.podman.compose.project"]
+		info.ComposeService = container.Labels["io.podman.compose.service"]
+	}
+	return info
+}
+
+func shortContainerID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// engineEndpoint is a Docker-compatible API reachable over a Unix socket or TCP.
+type engineEndpoint struct {
+	runtime string
+	network string
+	address string
+}
+
+// engineEndpoints lists the API sockets to try: DOCKER_HOST and
+// CONTAINER_HOST first, then the usual Docker and Podman locations.
+func engineEndpoints() []engineEndpoint {
+	var endpoints []engineEndpoint
+	seen := make(map[string]bool)
+	add := func(runtime, host string) {
+		if host == "" {
+			return
+		}
+		parsed, err := url.Parse(host)
+		if err != nil {
+			return
+		}
+		endpoint := engineEndpoint{runtime: runtime}
+		switch parsed.Scheme {
+		case "unix":
+			endpoint.network, endpoint.address = "unix", parsed.Path
+			if _, err := os.Stat(parsed.Path); err != nil {
+				return
+			}
+		case "tcp", "http":
+			endpoint.network, endpoint.address = "tcp", parsed.Host
+		default:
+			return
+		}
+		if !seen[endpoint.address] {
+			seen[endpoint.address] = true
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+
+	add("docker", os.Getenv("DOCKER_HOST"))
+	add("podman", os.Getenv("CONTAINER_HOST"))
+	home, _ := os.UserHomeDir()
+	add("docker", "unix:///var/run/docker.sock")
+	if home != "" {
+		add("docker", "unix://"+filepath.Join(home, ".docker", "run", "docker.sock"))
+		add("docker", "unix://"+filepath.Join(home, ".docker", "desktop", "docker.sock"))
+	}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		add("docker", "unix://"+filepath.Join(runtimeDir, "docker.sock"))
+		add("podman", "unix://"+filepath.Join(runtimeDir, "podman", "podman.sock"))
+	}
+	add("podman", "unix:///run/podman/podman.sock")
+	if home != "" {
+		matches, _ := filepath.Glob(filepath.Join(home, ".local", "share", "containers", "podman", "machine", "*", "podman.sock"))
+		for _, match := range matches {
+			add("podman", "unix://"+match)
+		}
+	}
+	return endpoints
+}
+
+// listEngineContainers returns the running containers of every reachable
+// engine. Unreachable engines are skipped silently.
+func listEngineContainers() []engineContainer {
+	var containers []engineContainer
+	for _, endpoint := range engineEndpoints() {
+		found, err := endpoint.containers()
+		if err != nil {
+			continue
+		}
+		containers = append(containers, found...)
+	}
+	return containers
+}
+
+// client returns an HTTP client that talks to the engine; request URLs use
+// the placeholder host "engine".
+func (e engineEndpoint) client(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, e.network, e.address)
+			},
+		},
+	}
+}
+
+func (e engineEndpoint) containers() ([]engineContainer, error) {
+	response, err := e.client(2 * time.Second).Get("http://engine/containers/json")
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s API returned %s", e.runtime, response.Status)
+	}
+
+	var containers []engineContainer
+	if err := json.NewDecoder(response.Body).Decode(&containers); err != nil {
+		return nil, err
+	}
+	for i := range containers {
+		containers[i].engine = e
+	}
+	return containers, nil
+}
+
+// describe formats a container for the one-line list view.
+func (c *containerInfo) describe() string {
+	name := c.Name
+	if name == "" {
+		name = c.ID
+	}
+	if c.ComposeProject != "" {
+		name += " (" + c.ComposeProject + "/" + c.ComposeService + ")"
+	}
+	if c.ContainerPort != "" {
+		name += fmt.Sprintf(" %d->%s", c.HostPort, c.ContainerPort)
+	}
+	return name
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// processRef names a related process in the tree around a listener.
+type processRef struct {
+	PID     int32  `json:"pid" yaml:"pid"`
+	Name    string `json:"name" yaml:"name"`
+	Cmdline string `json:"cmdline" yaml:"cmdline"`
+}
+
+// processContext is the extra detail shown for `ports <port>`: where the
+// listener sits in the process tree and what else it has open.
+type processContext struct {
+	Ancestors []processRef    `json:"ancestors" yaml:"ancestors"`
+	Children  []processRef    `json:"children" yaml:"children"`
+	Cwd       string          `json:"cwd,omitempty" yaml:"cwd,omitempty"`
+	OpenFiles int32           `json:"open_files" yaml:"open_files"`
+	Sockets   []socketSummary `json:"sockets" yaml:"sockets"`
+	Env       []string        `json:"env,omitempty" yaml:"env,omitempty"`
+}
+
+// socketSummary is one of the listener process's sockets.
+type socketSummary struct {
+	Protocol      string `json:"protocol" yaml:"protocol"`
+	LocalAddress  string `json:"local_address" yaml:"local_address"`
+	RemoteAddress string `json:"remote_address,omitempty" yaml:"remote_address,omitempty"`
+	State         string `json:"state,omitempty" yaml:"state,omitempty"`
+}
+
+// secretEnvName matches variable names whose values should not be printed.
+var secretEnvName = regexp.MustCompile(`(?i)(SECRET|TOKEN|PASSWORD|PASSWD|API_?KEY|ACCESS_?KEY|PRIVATE|CREDENTIAL|AUTH|SESSION|COOKIE|SIGNATURE|SALT)`)
+
+const redacted = "<redacted>"
+
+// inspectProcessContext gathers the ancestry, children, working directory,
+// open file count and sockets of pid. The environment is only read when
+// withEnv is set, and secret-looking values are redacted.
+func inspectProcessContext(pid int32, withEnv bool) *processContext {
+	// Lists are never nil so that JSON output has [] rather than null.
+	details := &processContext{Ancestors: []processRef{}, Children: []processRef{}, Sockets: []socketSummary{}}
+	proc, err := process.NewProcess(pid)
+	if err != nil {
+		return details
+	}
+
+	// Walk up to the root, guarding against PID reuse loops.
+	seen := map[int32]bool{pid: true}
+	for parent, err := proc.Parent(); err == nil && parent != nil && !seen[parent.Pid]; parent, err = parent.Parent() {
+		seen[parent.Pid] = true
+		details.Ancestors = append([]processRef{newProcessRef(parent)}, details.Ancestors...)
+		if parent.Pid <= 1 {
+			break
+		}
+	}
+
+	if children, err := proc.Children(); err == nil {
+		for _, child := range children {
+			details.Children = append(details.Children, newProcessRef(child))
+		}
+	}
+
+	details.Cwd, _ = proc.Cwd()
+	details.OpenFiles, _ = proc.NumFDs()
+
+	if connections, err := net.ConnectionsPid("inet", pid); err == nil {
+		for _, conn := range connections {
+			summary := socketSummary{
+				Protocol:     socketProtocol(conn),
+				LocalAddress: formatSocketAddr(conn.Laddr),
+				State:        conn.Status,
+			}
+			if conn.Raddr.Port != 0 {
+				summary.RemoteAddress = formatSocketAddr(conn.Raddr)
+			}
+			if summary.State == "NONE" {
+				summary.State = ""
+			}
+			details.Sockets = append(details.Sockets, summary)
+		}
+		sort.Slice(details.Sockets, func(i, j int) bool {
+			return details.Sockets[i].LocalAddress < details.Sockets[j].LocalAddress
+		})
+	}
+
+	if withEnv {
+		if env, err := proc.Environ(); err == nil {
+			for _, entry := range env {
+				if entry == "" {
+					continue
+				}
+				details.Env = append(details.Env, redactEnv(entry))
+			}
+			sort.Strings(details.Env)
+		}
+	}
+
+	return details
+}
+
+func newProcessRef(proc *process.Process) processRef {
+	ref := processRef{PID: proc.Pid}
+	ref.Name, _ = proc.Name()
+	ref.Cmdline, _ = proc.Cmdline()
+	return ref
+}
+
+// redactEnv hides the value of secret-looking variables and any password
+// embedded in URL values.
+func redactEnv(entry string) string {
+	name, value, ok := strings.Cut(entry, "=")
+	if !ok || value == "" {
+		return entry
+	}
+	if secretEnvName.MatchString(name) {
+		return name + "=" + redacted
+	}
+	if parsed, err := url.Parse(value); err == nil && parsed.User != nil {
+		if _, hasPassword := parsed.User.Password(); hasPassword {
+			parsed.User = url.UserPassword(parsed.User.Username(), "xxxxx")
+			return name + "=" + strings.Replace(parsed.String(), "xxxxx", redacted, 1)
+		}
+	}
+	return entry
+}
+
+// printProcessContext prints the tree from the root down to the listener
+// and its children, followed by its sockets and environment.
+func printProcessContext(record portRecord, details *processContext) {
+	fmt.Printf("Working Dir: %s\n", details.Cwd)
+	fmt.Printf("Open Files:  %d\n", details.OpenFiles)
+
+	fmt.Printf("\nProcess Tree:\n")
+	depth := 0
+	for _, ancestor := range details.Ancestors {
+		fmt.Printf("  %s\n", formatTreeLine(depth, ancestor, ""))
+		depth++
+	}
+	fmt.Printf("  %s\n", formatTreeLine(depth, processRef{PID: record.PID, Name: record.Name, Cmdline: record.Cmdline}, fmt.Sprintf("  <- listening on %d", record.Port)))
+	for _, child := range details.Children {
+		fmt.Printf("  %s\n", formatTreeLine(depth+1, child, ""))
+	}
+
+	if len(details.Sockets) > 0 {
+		fmt.Printf("\nSockets:\n")
+		for _, socket := range details.Sockets {
+			line := fmt.Sprintf("  %-5s %s", socket.Protocol, socket.LocalAddress)
+			if socket.RemoteAddress != "" {
+				line += " -> " + socket.RemoteAddress
+			}
+			if socket.State != "" {
+				line += " (" + socket.State + ")"
+			}
+			fmt.Println(line)
+		}
+	}
+
+	if len(details.Env) > 0 {
+		fmt.Printf("\nEnvironment:\n")
+		for _, entry := range details.Env {
+			fmt.Printf("  %s\n", entry)
+		}
+	}
+}
+
+func formatTreeLine(depth int, ref processRef, suffix string) string {
+	prefix := ""
+	if depth > 0 {
+		prefix = strings.Repeat("   ", depth-1) + "└─ "
+	}
+	cmdline := []rune(strings.Join(strings.Fields(ref.Cmdline), " "))
+	if len(cmdline) > 60 {
+		cmdline = append(cmdline[:57], []rune("...")...)
+	}
+	return fmt.Sprintf("%s%s (%d)  %s%s", prefix, ref.Name, ref.PID, string(cmdline), suffix)
+}
@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	psnet "github.com/shirou/gopsutil/v3/net"
+	"github.com/spf13/cobra"
+)
+
+var freeCount int
+var freeRange string
+var freeProject string
+var freeName string
+var freeFormat string
+var freeReserve time.Duration
+
+var portsFreeCmd = &cobra.Command{
+	Use:   "free",
+	Short: "Find unused TCP ports",
+	Long: `Finds unused TCP ports in a range and prints them as shell exports.
+
+A port is only reported when no socket is using it and it can actually be bound.
+Candidates are tried from a random offset in the range, so parallel runs rarely
+pick the same port. Use --project to also skip ports declared in a project's
+compose files, .env files, Procfiles and package.json scripts, and --reserve
+to keep a port from being handed out again by devtool for a while.`,
+	Example: `  devtool ports free
+  eval "$(devtool ports free --count 3 --range 3000-3999)"
+  devtool ports free --project . --name DB_PORT
+  devtool ports free -n 2 --format plain --reserve 1m`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if freeFormat != "export" && freeFormat != "plain" && freeFormat != "json" {
+			fmt.Printf("Invalid format %q. Must be one of: export, plain, json\n", freeFormat)
+			os.Exit(1)
+		}
+		if freeCount < 1 {
+			fmt.Println("Error: --count must be at least 1")
+			os.Exit(1)
+		}
+		start, end, err := parsePortRange(freeRange)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		avoid := make(map[int]bool)
+		if freeProject != "" {
+			declared, err := findProjectPorts(freeProject)
+			if err != nil {
+				fmt.Printf("Error reading project ports: %v\n", err)
+				os.Exit(1)
+			}
+			for _, declaredPort := range declared {
+				avoid[declaredPort.Port] = true
+			}
+		}
+
+		ports, err := findFreePorts(freeCount, start, end, avoid, freeReserve)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		switch freeFormat {
+		case "plain":
+			for _, port := range ports {
+				fmt.Println(port)
+			}
+		case "json":
+			payload, _ := json.Marshal(ports)
+			fmt.Println(string(payload))
+		default:
+			if len(ports) == 1 {
+				fmt.Printf("export %s=%d\n", freeName, ports[0])
+				return
+			}
+			for i, port := range ports {
+				fmt.Printf("export %s_%d=%d\n", freeName, i+1, port)
+			}
+		}
+	},
+}
+
+func init() {
+	portsCmd.AddCommand(portsFreeCmd)
+	portsFreeCmd.Flags().IntVarP(&freeCount, "count", "n", 1, "Number of ports to find")
+	portsFreeCmd.Flags().StringVarP(&freeRange, "range", "r", "20000-40000", "Port range to search, as START-END")
+	portsFreeCmd.Flags().StringVar(&freeProject, "project", "", "Skip ports declared by the project in this directory (see ports check)")
+	portsFreeCmd.Flags().StringVar(&freeName, "name", "PORT", "Variable name for export output (numbered when --count > 1)")
+	portsFreeCmd.Flags().StringVar(&freeFormat, "format", "export", "Output format: export, plain or json")
+	portsFreeCmd.Flags().DurationVar(&freeReserve, "reserve", 0, "Keep the ports reserved from other devtool runs for this long")
+}
+
+// parsePortRange parses "START-END" into an inclusive range.
+func parsePortRange(spec string) (int, int, error) {
+	startText, endText, ok := strings.Cut(spec, "-")
+	start, startErr := strconv.Atoi(strings.TrimSpace(startText))
+	end, endErr := strconv.Atoi(strings.TrimSpace(endText))
+	if !ok || startErr != nil || endErr != nil || !validPort(start) || !validPort(end) || end < start {
+		return 0, 0, fmt.Errorf("invalid port range %q, expected START-END between 1 and 65535", spec)
+	}
+	return start, end, nil
+}
+
+// findFreePorts returns count ports between start and end that no socket
+// uses, that can be bound, that are not in avoid and that no other devtool
+// run has reserved. With a non-zero reserve each port is also recorded so
+// that concurrent devtool runs skip it until the reservation expires.
+func findFreePorts(count, start, end int, avoid map[int]bool, reserve time.Duration) ([]int, error) {
+	inUse := make(map[int]bool)
+	connections, err := psnet.Connections("tcp")
+	if err != nil {
+		return nil, err
+	}
+	for _, conn := range connections {
+		inUse[int(conn.Laddr.Port)] = true
+	}
+
+	size := end - start + 1
+	offset := rand.Intn(size)
+	var ports []int
+	for i := 0; i < size && len(ports) < count; i++ {
+		port := start + (offset+i)%size
+		if avoid[port] || inUse[port] || !canBindPort(port) {
+			continue
+		}
+		if reserve > 0 {
+			if !reservePort(port, reserve) {
+				continue
+			}
+		} else if portReserved(port) {
+			continue
+		}
+		ports = append(ports, port)
+	}
+
+	if len(ports) < count {
+		if reserve > 0 {
+			for _, port := range ports {
+				os.Remove(portReservationPath(port))
+			}
+		}
+		return nil, fmt.Errorf("only found %d of %d free ports in %d-%d", len(ports), count, start, end)
+	}
+	return ports, nil
+}
+
+// canBindPort tries to listen on the port on all interfaces and on
+// loopback; some platforms allow the wildcard bind even when a loopback
+// listener exists.
+func canBindPort(port int) bool {
+	for _, address := range []string{fmt.Sprintf(":%d", port), fmt.Sprintf("127.0.0.1:%d", port)} {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return false
+		}
+		listener.Close()
+	}
+	return true
+}
+
+// reservePort atomically creates a lock file holding the reservation's
+// expiry. Expired reservations are taken over.
+func reservePort(port int, reserve time.Duration) bool {
+	path := portReservationPath(port)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return false
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, err = file.WriteString(time.Now().Add(reserve).Format(time.RFC3339Nano))
+			file.Close()
+			return err == nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return false
+		}
+
+		if portReserved(port) {
+			return false
+		}
+		os.Remove(path)
+	}
+	return false
+}
+
+// portReserved reports whether another run holds an unexpired reservation
+// for the port.
+func portReserved(port int) bool {
+	path := portReservationPath(port)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	expires, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+	if err != nil {
+		// Another run may have created the file but not written it yet.
+		info, statErr := os.Stat(path)
+		return statErr != nil || time.Since(info.ModTime()) < time.Minute
+	}
+	return time.Now().Before(expires)
+}
+
+func portReservationPath(port int) string {
+	return filepath.Join(os.TempDir(), "devtool-ports", fmt.Sprintf("%d.lock", port))
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+var portsOutputFormats = []string{"table", "json", "csv", "yaml"}
+
+func validPortsOutput(format string) bool {
+	for _, known := range portsOutputFormats {
+		if format == known {
+			return true
+		}
+	}
+	return false
+}
+
+// writePortRecords writes records in one of the machine readable formats.
+// An empty result is still valid output ([] for JSON, a header row for CSV).
+func writePortRecords(w io.Writer, records []portRecord, format string) error {
+	if records == nil {
+		records = []portRecord{}
+	}
+
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case "yaml":
+		payload, err := yaml.Marshal(records)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(payload)
+		return err
+	default:
+		return writePortRecordsCSV(w, records)
+	}
+}
+
+func writePortRecordsCSV(w io.Writer, records []portRecord) error {
+	writer := csv.NewWriter(w)
+	header := []string{
+		"pid", "name", "exe", "user", "protocol", "local_address", "bind_ip", "port",
+		"remote_address", "socket_state", "status", "rss_bytes", "start_time", "cmdline",
+		"container_id", "container_image", "container_name", "container_runtime",
+		"compose_project", "compose_service", "host_port", "container_port",
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		var startTime string
+		if record.StartTime != nil {
+			startTime = record.StartTime.Format(time.RFC3339)
+		}
+		row := []string{
+			strconv.Itoa(int(record.PID)),
+			record.Name,
+			record.Exe,
+			record.User,
+			record.Protocol,
+			record.LocalAddress,
+			record.BindIP,
+			strconv.FormatUint(uint64(record.Port), 10),
+			record.RemoteAddress,
+			record.SocketState,
+			record.Status,
+			strconv.FormatUint(record.RSS, 10),
+			startTime,
+			record.Cmdline,
+		}
+		if record.Container != nil {
+			container := record.Container
+			row = append(row, container.ID, container.Image, container.Name, container.Runtime,
+				container.ComposeProject, container.ComposeService,
+				strconv.Itoa(int(container.HostPort)), container.ContainerPort)
+		} else {
+			row = append(row, "", "", "", "", "", "", "", "")
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,321 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// projectPort is a host port a project expects to bind, and where it was
+// declared.
+type projectPort struct {
+	Port   int    `json:"port" yaml:"port"`
+	Source string `json:"source" yaml:"source"`
+	Name   string `json:"name" yaml:"name"`
+	// Protocol is "udp" for compose ports published as UDP, otherwise empty
+	// for TCP.
+	Protocol string `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+}
+
+var composeFileNames = []string{
+	"compose.yaml", "compose.yml",
+	"docker-compose.yaml", "docker-compose.yml",
+	"docker-compose.override.yaml", "docker-compose.override.yml",
+}
+
+// commandPort matches the ways dev server commands usually name a port:
+// --port 3000, -p 3000, PORT=3000, ${PORT:-3000} and host:port binds.
+var commandPort = regexp.MustCompile(`(?:--port[= ]+|(?:^|\s)-p[= ]?|\bPORT=|\bPORT:?-|(?:localhost|0\.0\.0\.0|127\.0\.0\.1|\[::\]):)(\d{2,5})\b`)
+
+// envReference matches ${VAR}, ${VAR:-default}, ${VAR-default} and $VAR.
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::?-([^}]*))?\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// findProjectPorts collects the host ports declared by the compose files,
+// .env files, Procfiles and package.json scripts in dir, sorted by port.
+func findProjectPorts(dir string) ([]projectPort, error) {
+	envFiles, err := filepath.Glob(filepath.Join(dir, ".env*"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(envFiles)
+
+	var ports []projectPort
+	env := make(map[string]string)
+	for _, path := range envFiles {
+		found, values, err := parseEnvFilePorts(path)
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, found...)
+		// .env is what compose itself reads for interpolation.
+		if filepath.Base(path) == ".env" {
+			env = values
+		}
+	}
+
+	for _, name := range composeFileNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		found, err := parseComposePorts(path, env)
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, found...)
+	}
+
+	procfiles, err := filepath.Glob(filepath.Join(dir, "Procfile*"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(procfiles)
+	for _, path := range procfiles {
+		found, err := parseProcfilePorts(path)
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, found...)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "package.json")); err == nil {
+		found, err := parsePackageJSONPorts(filepath.Join(dir, "package.json"))
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, found...)
+	}
+
+	sort.SliceStable(ports, func(i, j int) bool { return ports[i].Port < ports[j].Port })
+	return ports, nil
+}
+
+// parseProcfilePorts reads "name: command" lines and reports ports named in
+// the commands.
+func parseProcfilePorts(path string) ([]projectPort, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ports []projectPort
+	for i, line := range strings.Split(string(data), "\n") {
+		name, command, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		source := fmt.Sprintf("%s:%d", filepath.Base(path), i+1)
+		for _, port := range commandPorts(command) {
+			ports = append(ports, projectPort{Port: port, Source: source, Name: name})
+		}
+	}
+	return ports, nil
+}
+
+// parsePackageJSONPorts reports ports named in package.json scripts.
+func parsePackageJSONPorts(path string) ([]projectPort, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	names := make([]string, 0, len(manifest.Scripts))
+	for name := range manifest.Scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var ports []projectPort
+	for _, name := range names {
+		for _, port := range commandPorts(manifest.Scripts[name]) {
+			ports = append(ports, projectPort{Port: port, Source: "package.json", Name: "npm run " + name})
+		}
+	}
+	return ports, nil
+}
+
+// commandPorts returns the distinct ports a shell command refers to.
+func commandPorts(command string) []int {
+	var ports []int
+	seen := make(map[int]bool)
+	for _, match := range commandPort.FindAllStringSubmatch(command, -1) {
+		port, err := strconv.Atoi(match[1])
+		if err != nil || !validPort(port) || seen[port] {
+			continue
+		}
+		seen[port] = true
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+// parseEnvFilePorts reads KEY=VALUE lines, reporting numeric values of
+// *PORT* variables and ports embedded in URL values.
+func parseEnvFilePorts(path string) ([]projectPort, map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	var ports []projectPort
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		values[key] = value
+
+		source := fmt.Sprintf("%s:%d", filepath.Base(path), lineNumber)
+		if port, err := strconv.Atoi(value); err == nil && strings.Contains(strings.ToUpper(key), "PORT") && validPort(port) {
+			ports = append(ports, projectPort{Port: port, Source: source, Name: key})
+			continue
+		}
+		if parsed, err := url.Parse(value); err == nil && parsed.Host != "" {
+			if port, err := strconv.Atoi(parsed.Port()); err == nil && validPort(port) {
+				ports = append(ports, projectPort{Port: port, Source: source, Name: key})
+			}
+		}
+	}
+	return ports, values, scanner.Err()
+}
+
+type composeProject struct {
+	Services map[string]struct {
+		Ports []interface{} `yaml:"ports"`
+	} `yaml:"services"`
+}
+
+// parseComposePorts returns the published host ports of every service.
+// Container-only entries such as "80" publish a random port and are skipped.
+func parseComposePorts(path string, env map[string]string) ([]projectPort, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var project composeProject
+	if err := yaml.Unmarshal(data, &project); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	names := make([]string, 0, len(project.Services))
+	for name := range project.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var ports []projectPort
+	for _, service := range names {
+		source := filepath.Base(path)
+		for _, entry := range project.Services[service].Ports {
+			var published, protocol string
+			switch value := entry.(type) {
+			case string:
+				spec := interpolateEnv(value, env)
+				published = composeShortPublished(spec)
+				if _, suffix, ok := strings.Cut(spec, "/"); ok && strings.EqualFold(suffix, "udp") {
+					protocol = "udp"
+				}
+			case int:
+				// A bare container port; nothing is published on a fixed host port.
+			case map[interface{}]interface{}:
+				published = interpolateEnv(fmt.Sprint(value["published"]), env)
+				if strings.EqualFold(fmt.Sprint(value["protocol"]), "udp") {
+					protocol = "udp"
+				}
+			}
+
+			for _, port := range expandPortRange(published) {
+				ports = append(ports, projectPort{Port: port, Source: source, Name: service, Protocol: protocol})
+			}
+		}
+	}
+	return ports, nil
+}
+
+// composeShortPublished extracts the host part of "[IP:]HOST:CONTAINER[/proto]".
+func composeShortPublished(spec string) string {
+	spec, _, _ = strings.Cut(spec, "/")
+	if strings.HasPrefix(spec, "[") {
+		// Bracketed IPv6 bind address, e.g. "[::1]:8080:80".
+		if _, rest, ok := strings.Cut(spec, "]:"); ok {
+			spec = rest
+		}
+	}
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[len(parts)-2]
+}
+
+// expandPortRange turns "8080" or "8080-8082" into its ports.
+func expandPortRange(spec string) []int {
+	startText, endText, isRange := strings.Cut(strings.TrimSpace(spec), "-")
+	start, err := strconv.Atoi(startText)
+	if err != nil || !validPort(start) {
+		return nil
+	}
+	end := start
+	if isRange {
+		end, err = strconv.Atoi(endText)
+		if err != nil || !validPort(end) || end < start {
+			return nil
+		}
+	}
+
+	ports := make([]int, 0, end-start+1)
+	for port := start; port <= end; port++ {
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+// interpolateEnv substitutes compose-style variable references, preferring
+// the process environment, then .env values, then the inline default.
+func interpolateEnv(value string, env map[string]string) string {
+	return envReference.ReplaceAllStringFunc(value, func(ref string) string {
+		match := envReference.FindStringSubmatch(ref)
+		name, fallback := match[1], match[2]
+		if name == "" {
+			name = match[3]
+		}
+		if resolved, ok := os.LookupEnv(name); ok && resolved != "" {
+			return resolved
+		}
+		if resolved, ok := env[name]; ok && resolved != "" {
+			return resolved
+		}
+		return fallback
+	})
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
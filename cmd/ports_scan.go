@@ -0,0 +1,298 @@
+package cmd
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+var scanPorts string
+var scanWorkers int
+var scanTimeout time.Duration
+var scanBanner bool
+var scanOutput string
+
+var portsScanCmd = &cobra.Command{
+	Use:   "scan [host]",
+	Short: "Scan a host for open TCP ports",
+	Long: `Scans a host (default localhost) for open TCP ports using concurrent connect
+attempts, then grabs a best-effort banner from each open port: the greeting
+sent by protocols such as SSH, SMTP or Redis, or the status, Server header and
+page title of HTTP and HTTPS services.
+
+Only scan hosts you are allowed to probe.`,
+	Example: `  devtool ports scan
+  devtool ports scan 192.168.64.2 --ports 1-65535
+  devtool ports scan localhost --ports 3000-3010,5432,6379 --timeout 200ms
+  devtool ports scan --output json`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		host := "localhost"
+		if len(args) > 0 {
+			host = args[0]
+		}
+		if scanOutput != "table" && scanOutput != "json" {
+			fmt.Printf("Invalid output format %q. Must be one of: table, json\n", scanOutput)
+			os.Exit(1)
+		}
+		if scanWorkers < 1 {
+			fmt.Println("Error: --workers must be at least 1")
+			os.Exit(1)
+		}
+		if scanTimeout <= 0 {
+			fmt.Println("Error: --timeout must be greater than 0")
+			os.Exit(1)
+		}
+
+		ports, err := parsePortList(scanPorts)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		started := time.Now()
+		results := scanHost(host, ports)
+
+		if scanOutput == "json" {
+			if results == nil {
+				results = []scanResult{}
+			}
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(results); err != nil {
+				fmt.Printf("Error writing output: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "PORT\tSERVICE\tBANNER")
+		for _, result := range results {
+			fmt.Fprintf(w, "%d\t%s\t%s\n", result.Port, result.Service, result.Banner)
+		}
+		w.Flush()
+		fmt.Printf("\n%d open of %d scanned on %s in %s\n", len(results), len(ports), host, time.Since(started).Round(time.Millisecond))
+	},
+}
+
+func init() {
+	portsCmd.AddCommand(portsScanCmd)
+	portsScanCmd.Flags().StringVarP(&scanPorts, "ports", "p", "1-10000", "Ports to scan, e.g. 1-1024,3000-3010,5432")
+	portsScanCmd.Flags().IntVarP(&scanWorkers, "workers", "w", 200, "Number of concurrent connection attempts")
+	portsScanCmd.Flags().DurationVarP(&scanTimeout, "timeout", "t", 500*time.Millisecond, "Connect and banner read timeout per port")
+	portsScanCmd.Flags().BoolVar(&scanBanner, "banner", true, "Grab a service banner or HTTP title from open ports")
+	portsScanCmd.Flags().StringVarP(&scanOutput, "output", "o", "table", "Output format: table or json")
+}
+
+// scanResult is one open port.
+type scanResult struct {
+	Port    int    `json:"port"`
+	Service string `json:"service"`
+	Banner  string `json:"banner,omitempty"`
+}
+
+// wellKnownServices names the services commonly found on development hosts.
+var wellKnownServices = map[int]string{
+	21: "ftp", 22: "ssh", 25: "smtp", 53: "dns", 80: "http", 110: "pop3", 143: "imap",
+	443: "https", 465: "smtps", 587: "submission", 993: "imaps", 995: "pop3s",
+	1025: "smtp-dev", 1433: "mssql", 1521: "oracle", 2181: "zookeeper", 2375: "docker",
+	2376: "docker-tls", 3000: "http-dev", 3306: "mysql", 4200: "angular", 5000: "http-dev",
+	5173: "vite", 5432: "postgres", 5672: "amqp", 6379: "redis", 8000: "http-alt",
+	8025: "mailhog", 8080: "http-alt", 8443: "https-alt", 8888: "http-alt", 9000: "http-alt",
+	9092: "kafka", 9200: "elasticsearch", 9229: "node-inspect", 11211: "memcached",
+	15672: "rabbitmq", 27017: "mongodb",
+}
+
+// parsePortList parses comma separated ports and START-END ranges into a
+// sorted list without duplicates.
+func parsePortList(spec string) ([]int, error) {
+	seen := make(map[int]bool)
+	var ports []int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		expanded := expandPortRange(part)
+		if expanded == nil {
+			return nil, fmt.Errorf("invalid port or range %q", part)
+		}
+		for _, port := range expanded {
+			if !seen[port] {
+				seen[port] = true
+				ports = append(ports, port)
+			}
+		}
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports given")
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// scanHost tries every port with a pool of --workers goroutines and returns
+// the open ones in port order.
+func scanHost(host string, ports []int) []scanResult {
+	jobs := make(chan int)
+	var mu sync.Mutex
+	var results []scanResult
+	var wg sync.WaitGroup
+
+	for i := 0; i < scanWorkers && i < len(ports); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for port := range jobs {
+				result, open := scanPort(host, port)
+				if !open {
+					continue
+				}
+				mu.Lock()
+				results = append(results, result)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, port := range ports {
+		jobs <- port
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Port < results[j].Port })
+	return results
+}
+
+func scanPort(host string, port int) (scanResult, bool) {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	conn, err := net.DialTimeout("tcp", address, scanTimeout)
+	if err != nil {
+		return scanResult{}, false
+	}
+
+	result := scanResult{Port: port, Service: wellKnownServices[port]}
+	if result.Service == "" {
+		result.Service = "unknown"
+	}
+	if !scanBanner {
+		conn.Close()
+		return result, true
+	}
+
+	// Protocols like SSH and SMTP greet first; otherwise try HTTP, then HTTPS.
+	banner := readBanner(conn)
+	conn.Close()
+	if banner == "" || looksLikeTLS(banner) {
+		plain := grabHTTPBanner(host, address, false)
+		// TLS servers often answer plain HTTP with 400 or not at all.
+		if plain == "" || strings.HasPrefix(plain, "HTTP 400") {
+			if secure := grabHTTPBanner(host, address, true); secure != "" {
+				plain = secure
+			}
+		}
+		if plain != "" {
+			result.Banner = plain
+			return result, true
+		}
+	}
+	result.Banner = cleanBanner(banner)
+	return result, true
+}
+
+func readBanner(conn net.Conn) string {
+	conn.SetReadDeadline(time.Now().Add(scanTimeout))
+	buffer := make([]byte, 512)
+	n, _ := conn.Read(buffer)
+	return string(buffer[:n])
+}
+
+// looksLikeTLS reports whether data starts with a TLS record header.
+func looksLikeTLS(data string) bool {
+	return len(data) >= 3 && data[0] >= 0x14 && data[0] <= 0x17 && data[1] == 0x03
+}
+
+var htmlTitle = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// grabHTTPBanner sends a GET / and summarises the response as
+// "HTTP 200 OK | Server: nginx | Title: Welcome".
+func grabHTTPBanner(host, address string, useTLS bool) string {
+	dialer := &net.Dialer{Timeout: scanTimeout}
+	var conn net.Conn
+	var err error
+	if useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{InsecureSkipVerify: true, ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(2 * scanTimeout))
+	fmt.Fprintf(conn, "GET / HTTP/1.0\r\nHost: %s\r\nUser-Agent: devtool\r\nAccept: text/html\r\n\r\n", host)
+	response, _ := io.ReadAll(io.LimitReader(conn, 64*1024))
+
+	reader := bufio.NewReader(strings.NewReader(string(response)))
+	statusLine, _ := reader.ReadString('\n')
+	if !strings.HasPrefix(statusLine, "HTTP/") {
+		return ""
+	}
+
+	scheme := "HTTP"
+	if useTLS {
+		scheme = "HTTPS"
+	}
+	_, status, _ := strings.Cut(strings.TrimSpace(statusLine), " ")
+	parts := []string{strings.TrimSpace(scheme + " " + status)}
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" || err != nil {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Server") {
+			parts = append(parts, "Server: "+strings.TrimSpace(value))
+		}
+	}
+	if match := htmlTitle.FindStringSubmatch(string(response)); match != nil {
+		if title := strings.Join(strings.Fields(html.UnescapeString(match[1])), " "); title != "" {
+			parts = append(parts, "Title: "+title)
+		}
+	}
+	return strings.Join(parts, " | ")
+}
+
+// cleanBanner keeps the first line of a greeting, with non-printable
+// characters removed.
+func cleanBanner(banner string) string {
+	banner, _, _ = strings.Cut(banner, "\n")
+	banner = strings.Map(func(r rune) rune {
+		if unicode.IsPrint(r) {
+			return r
+		}
+		return -1
+	}, banner)
+	if runes := []rune(banner); len(runes) > 80 {
+		banner = string(runes[:77]) + "..."
+	}
+	return strings.TrimSpace(banner)
+}
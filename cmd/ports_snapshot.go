@@ -0,0 +1,362 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var diffExitCode bool
+var diffOutput string
+
+var portsSnapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Save and manage snapshots of listening ports",
+	Long: `Saves the current set of listeners (process, protocol, bind address and port)
+so that it can later be compared with 'devtool ports diff'.
+
+Snapshots are stored in the devtool config directory. A name containing a path
+separator or ending in .json is used as a file path instead.`,
+}
+
+var portsSnapshotSaveCmd = &cobra.Command{
+	Use:   "save <name>",
+	Short: "Save the current listeners under a name",
+	Example: `  devtool ports snapshot save before-tests
+  devtool ports snapshot save ./artifacts/ports.json`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		records, err := listeningRecords()
+		if err != nil {
+			fmt.Printf("Error fetching connections: %v\n", err)
+			os.Exit(1)
+		}
+
+		snapshot := portSnapshot{Name: args[0], CreatedAt: time.Now()}
+		for _, record := range records {
+			snapshot.Listeners = append(snapshot.Listeners, newSnapshotListener(record))
+		}
+
+		path, err := snapshotPath(args[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			fmt.Printf("Error creating snapshot directory: %v\n", err)
+			os.Exit(1)
+		}
+		payload, _ := json.MarshalIndent(snapshot, "", "  ")
+		if err := os.WriteFile(path, payload, 0o644); err != nil {
+			fmt.Printf("Error writing snapshot: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Saved %d listeners to %s\n", len(snapshot.Listeners), path)
+	},
+}
+
+var portsSnapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List saved snapshots",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, err := snapshotDir()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		if len(paths) == 0 {
+			fmt.Println("No snapshots saved.")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "NAME\tCREATED\tLISTENERS")
+		for _, path := range paths {
+			snapshot, err := loadSnapshot(path)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\n", strings.TrimSuffix(filepath.Base(path), ".json"), snapshot.CreatedAt.Format(time.RFC1123), len(snapshot.Listeners))
+		}
+		w.Flush()
+	},
+}
+
+var portsSnapshotDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a saved snapshot",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := snapshotPath(args[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := os.Remove(path); err != nil {
+			fmt.Printf("Error deleting snapshot: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Deleted snapshot %s\n", args[0])
+	},
+}
+
+var portsDiffCmd = &cobra.Command{
+	Use:   "diff <name>",
+	Short: "Compare current listeners with a saved snapshot",
+	Long: `Compares the current listeners with a snapshot saved by 'devtool ports snapshot save'
+and shows listeners that were added or removed since. A listener that is still
+there under a different PID (a restarted server) is reported as changed.
+
+Use --exit-code to exit with status 1 when anything changed, for example to fail
+a CI job when a test suite leaks servers.`,
+	Example: `  devtool ports snapshot save before-tests
+  npm test
+  devtool ports diff before-tests --exit-code`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if diffOutput != "table" && diffOutput != "json" {
+			fmt.Printf("Invalid output format %q. Must be one of: table, json\n", diffOutput)
+			os.Exit(1)
+		}
+
+		path, err := snapshotPath(args[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		snapshot, err := loadSnapshot(path)
+		if err != nil {
+			fmt.Printf("Error reading snapshot %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+		records, err := listeningRecords()
+		if err != nil {
+			fmt.Printf("Error fetching connections: %v\n", err)
+			os.Exit(1)
+		}
+		current := make([]snapshotListener, 0, len(records))
+		for _, record := range records {
+			current = append(current, newSnapshotListener(record))
+		}
+
+		diff := diffSnapshots(snapshot.Listeners, current)
+		if diffOutput == "json" {
+			payload, _ := json.MarshalIndent(diff, "", "  ")
+			fmt.Println(string(payload))
+		} else {
+			printSnapshotDiff(snapshot, diff)
+		}
+
+		if diffExitCode && !diff.empty() {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	portsCmd.AddCommand(portsSnapshotCmd)
+	portsCmd.AddCommand(portsDiffCmd)
+	portsSnapshotCmd.AddCommand(portsSnapshotSaveCmd)
+	portsSnapshotCmd.AddCommand(portsSnapshotListCmd)
+	portsSnapshotCmd.AddCommand(portsSnapshotDeleteCmd)
+
+	portsDiffCmd.Flags().BoolVar(&diffExitCode, "exit-code", false, "Exit with status 1 if listeners were added, removed or changed")
+	portsDiffCmd.Flags().StringVarP(&diffOutput, "output", "o", "table", "Output format: table or json")
+}
+
+// portSnapshot is the file format written by `ports snapshot save`.
+type portSnapshot struct {
+	Name      string             `json:"name"`
+	CreatedAt time.Time          `json:"created_at"`
+	Listeners []snapshotListener `json:"listeners"`
+}
+
+type snapshotListener struct {
+	PID          int32  `json:"pid"`
+	Name         string `json:"name"`
+	Protocol     string `json:"protocol"`
+	BindIP       string `json:"bind_ip"`
+	Port         uint32 `json:"port"`
+	LocalAddress string `json:"local_address"`
+	Cmdline      string `json:"cmdline"`
+}
+
+// key identifies a listener across snapshots. The PID is left out so a
+// restarted server counts as the same listener.
+func (l snapshotListener) key() string {
+	return l.Protocol + "|" + l.LocalAddress + "|" + l.Name
+}
+
+type snapshotDiff struct {
+	Added   []snapshotListener `json:"added"`
+	Removed []snapshotListener `json:"removed"`
+	Changed []snapshotListener `json:"changed"`
+}
+
+func (d snapshotDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+func newSnapshotListener(record portRecord) snapshotListener {
+	return snapshotListener{
+		PID:          record.PID,
+		Name:         record.Name,
+		Protocol:     record.Protocol,
+		BindIP:       record.BindIP,
+		Port:         record.Port,
+		LocalAddress: record.LocalAddress,
+		Cmdline:      record.Cmdline,
+	}
+}
+
+// diffSnapshots compares the listeners per key. Several processes can share
+// a key (SO_REUSEPORT, prefork workers), so listeners with the same PID on
+// both sides are matched first; the rest are paired up as restarted, and
+// whatever is left over was added or removed.
+func diffSnapshots(before, after []snapshotListener) snapshotDiff {
+	diff := snapshotDiff{Added: []snapshotListener{}, Removed: []snapshotListener{}, Changed: []snapshotListener{}}
+	beforeByKey := make(map[string][]snapshotListener, len(before))
+	for _, listener := range before {
+		beforeByKey[listener.key()] = append(beforeByKey[listener.key()], listener)
+	}
+	afterByKey := make(map[string][]snapshotListener, len(after))
+	var keys []string
+	for _, listener := range after {
+		if _, seen := afterByKey[listener.key()]; !seen {
+			keys = append(keys, listener.key())
+		}
+		afterByKey[listener.key()] = append(afterByKey[listener.key()], listener)
+	}
+
+	for _, key := range keys {
+		previous := beforeByKey[key]
+		var restarted []snapshotListener
+		for _, listener := range afterByKey[key] {
+			if i := indexOfPID(previous, listener.PID); i >= 0 {
+				previous = append(previous[:i:i], previous[i+1:]...)
+				continue
+			}
+			restarted = append(restarted, listener)
+		}
+		for _, listener := range restarted {
+			if len(previous) == 0 {
+				diff.Added = append(diff.Added, listener)
+				continue
+			}
+			previous = previous[1:]
+			diff.Changed = append(diff.Changed, listener)
+		}
+		beforeByKey[key] = previous
+	}
+	for _, listener := range before {
+		if remaining, ok := beforeByKey[listener.key()]; ok {
+			diff.Removed = append(diff.Removed, remaining...)
+			delete(beforeByKey, listener.key())
+		}
+	}
+
+	for _, list := range [][]snapshotListener{diff.Added, diff.Removed, diff.Changed} {
+		sort.Slice(list, func(i, j int) bool { return list[i].Port < list[j].Port })
+	}
+	return diff
+}
+
+func indexOfPID(listeners []snapshotListener, pid int32) int {
+	for i, listener := range listeners {
+		if listener.PID == pid {
+			return i
+		}
+	}
+	return -1
+}
+
+func printSnapshotDiff(snapshot *portSnapshot, diff snapshotDiff) {
+	fmt.Printf("Comparing with snapshot %q from %s\n\n", snapshot.Name, snapshot.CreatedAt.Format(time.RFC1123))
+	if diff.empty() {
+		fmt.Println("No changes.")
+		return
+	}
+
+	type diffRow struct {
+		mark     string
+		color    string
+		listener snapshotListener
+	}
+	var rows []diffRow
+	for _, listener := range diff.Added {
+		rows = append(rows, diffRow{"+", "32", listener})
+	}
+	for _, listener := range diff.Removed {
+		rows = append(rows, diffRow{"-", "31", listener})
+	}
+	for _, listener := range diff.Changed {
+		rows = append(rows, diffRow{"~", "33", listener})
+	}
+
+	var table bytes.Buffer
+	w := tabwriter.NewWriter(&table, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, " \tPID\tNAME\tPROTO\tADDRESS\tPORT\tCOMMAND")
+	for _, row := range rows {
+		command := row.listener.Cmdline
+		if runes := []rune(command); len(runes) > 60 {
+			command = string(runes[:57]) + "..."
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%d\t%s\n", row.mark, row.listener.PID, row.listener.Name, row.listener.Protocol, row.listener.BindIP, row.listener.Port, command)
+	}
+	w.Flush()
+
+	// Colour whole lines after alignment so escape codes do not skew the columns.
+	color := stdoutIsTerminal()
+	lines := strings.Split(strings.TrimRight(table.String(), "\n"), "\n")
+	fmt.Println(lines[0])
+	for i, line := range lines[1:] {
+		if color {
+			line = "\033[" + rows[i].color + "m" + line + "\033[0m"
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("\n%d added, %d removed, %d restarted with a new PID\n", len(diff.Added), len(diff.Removed), len(diff.Changed))
+}
+
+func snapshotDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "devtool", "port-snapshots"), nil
+}
+
+// snapshotPath maps a snapshot name to its file; names that look like
+// paths are used as they are.
+func snapshotPath(name string) (string, error) {
+	if strings.ContainsRune(name, '/') || strings.ContainsRune(name, filepath.Separator) || strings.HasSuffix(name, ".json") {
+		return name, nil
+	}
+	dir, err := snapshotDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+func loadSnapshot(path string) (*portSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot portSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var waitTimeout time.Duration
+var waitInterval time.Duration
+var waitClosed bool
+var waitHTTP []string
+var waitQuiet bool
+
+var portsWaitCmd = &cobra.Command{
+	Use:   "wait <port|host:port>...",
+	Short: "Wait until ports accept connections (or close)",
+	Long: `Blocks until every target accepts TCP connections, then exits 0.
+
+A bare port number means a local port. With --closed, waits until every target
+stops accepting connections instead. With --http, the given URLs must also
+answer with a 2xx status before the wait succeeds.
+
+Exits with status 1 if the timeout expires first. A timeout of 0 waits forever.`,
+	Example: `  devtool ports wait 5432 8080 --timeout 60s
+  devtool ports wait db:5432 redis:6379
+  devtool ports wait 3000 --http http://localhost:3000/health
+  devtool ports wait 8080 --closed`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if waitInterval < 100*time.Millisecond {
+			fmt.Println("Error: --interval must be at least 100ms")
+			os.Exit(1)
+		}
+
+		targets := make([]string, 0, len(args))
+		for _, arg := range args {
+			target, err := parseWaitTarget(arg)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			targets = append(targets, target)
+		}
+		for _, rawURL := range waitHTTP {
+			parsed, err := url.Parse(rawURL)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				fmt.Printf("Error: invalid health URL %q\n", rawURL)
+				os.Exit(1)
+			}
+		}
+
+		ctx := context.Background()
+		if waitTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, waitTimeout)
+			defer cancel()
+		}
+
+		started := time.Now()
+		pending := waitForTargets(ctx, targets, started)
+		if len(pending) == 0 {
+			pending = waitForHealth(ctx, waitHTTP, started)
+		}
+
+		if len(pending) > 0 {
+			fmt.Fprintf(os.Stderr, "Timed out after %s waiting for: %s\n", waitTimeout, strings.Join(pending, ", "))
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	portsCmd.AddCommand(portsWaitCmd)
+	portsWaitCmd.Flags().DurationVarP(&waitTimeout, "timeout", "t", 60*time.Second, "Give up after this long (0 waits forever)")
+	portsWaitCmd.Flags().DurationVar(&waitInterval, "interval", 500*time.Millisecond, "Time between attempts")
+	portsWaitCmd.Flags().BoolVar(&waitClosed, "closed", false, "Wait until the ports stop accepting connections")
+	portsWaitCmd.Flags().StringArrayVar(&waitHTTP, "http", nil, "Health URL that must return a 2xx status (repeatable)")
+	portsWaitCmd.Flags().BoolVarP(&waitQuiet, "quiet", "q", false, "Only print errors")
+}
+
+// parseWaitTarget turns "8080" into "localhost:8080" and validates host:port.
+func parseWaitTarget(arg string) (string, error) {
+	if port, err := strconv.Atoi(arg); err == nil {
+		if !validPort(port) {
+			return "", fmt.Errorf("invalid port %q", arg)
+		}
+		return net.JoinHostPort("localhost", arg), nil
+	}
+
+	host, portText, err := net.SplitHostPort(arg)
+	if err != nil {
+		return "", fmt.Errorf("invalid target %q, expected PORT or HOST:PORT", arg)
+	}
+	if port, err := strconv.Atoi(portText); err != nil || !validPort(port) || host == "" {
+		return "", fmt.Errorf("invalid target %q, expected PORT or HOST:PORT", arg)
+	}
+	return arg, nil
+}
+
+// waitForTargets polls every target concurrently and returns the ones that
+// did not reach the wanted state before ctx ended.
+func waitForTargets(ctx context.Context, targets []string, started time.Time) []string {
+	var mu sync.Mutex
+	var pending []string
+	var wg sync.WaitGroup
+
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+			if !pollUntil(ctx, target, func() bool { return acceptsConnections(ctx, target) != waitClosed }) {
+				mu.Lock()
+				pending = append(pending, target)
+				mu.Unlock()
+				return
+			}
+			if !waitQuiet {
+				state := "accepting connections"
+				if waitClosed {
+					state = "closed"
+				}
+				fmt.Printf("%s is %s (%s)\n", target, state, time.Since(started).Round(time.Millisecond))
+			}
+		}(target)
+	}
+
+	wg.Wait()
+	return pending
+}
+
+// waitForHealth polls each URL until it answers with a 2xx status.
+func waitForHealth(ctx context.Context, urls []string, started time.Time) []string {
+	var pending []string
+	for _, healthURL := range urls {
+		if !pollUntil(ctx, healthURL, func() bool { return healthy(ctx, healthURL) }) {
+			pending = append(pending, healthURL)
+			continue
+		}
+		if !waitQuiet {
+			fmt.Printf("%s is healthy (%s)\n", healthURL, time.Since(started).Round(time.Millisecond))
+		}
+	}
+	return pending
+}
+
+// pollUntil calls ready every --interval until it succeeds or ctx ends.
+// A result observed after ctx ended is ignored, since a cancelled dial
+// would otherwise look like a closed port.
+func pollUntil(ctx context.Context, target string, ready func() bool) bool {
+	announced := false
+	for {
+		if ready() && ctx.Err() == nil {
+			return true
+		}
+		if !announced && !waitQuiet {
+			fmt.Printf("Waiting for %s...\n", target)
+			announced = true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(waitInterval):
+		}
+	}
+}
+
+func acceptsConnections(ctx context.Context, target string) bool {
+	dialer := net.Dialer{Timeout: time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func healthy(ctx context.Context, healthURL string) bool {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL, nil)
+	if err != nil {
+		return false
+	}
+	client := http.Client{Timeout: 5 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return false
+	}
+	response.Body.Close()
+	return response.StatusCode >= 200 && response.StatusCode < 300
+}
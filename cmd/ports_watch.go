@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// portsWatchHighlight is how long opened and closed ports stay highlighted
+// in the redrawn table.
+const portsWatchHighlight = 10 * time.Second
+
+// portEvent is emitted when a listener appears or disappears.
+type portEvent struct {
+	Time  time.Time `json:"timestamp"`
+	Event string    `json:"event"`
+	portRecord
+}
+
+// portChange remembers when a listener last changed, for highlighting.
+type portChange struct {
+	event  string
+	at     time.Time
+	record portRecord
+}
+
+func portRecordKey(record portRecord) string {
+	return fmt.Sprintf("%s|%s|%d", record.Protocol, record.LocalAddress, record.PID)
+}
+
+// watchPorts polls the listener list until interrupted. On a terminal the
+// table is redrawn in place; otherwise, or with --events, one line is
+// printed per change.
+func watchPorts() {
+	redraw := !portsWatchEvents && portsOutput == "table" && stdoutIsTerminal()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	ticker := time.NewTicker(portsWatchInterval)
+	defer ticker.Stop()
+
+	if !redraw && portsOutput == "table" {
+		fmt.Fprintf(os.Stderr, "Watching listening ports every %s (Ctrl+C to stop)\n", portsWatchInterval)
+	}
+
+	var previous map[string]portRecord
+	changes := make(map[string]portChange)
+	for {
+		records, err := listeningRecords()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error fetching connections: %v\n", err)
+		} else {
+			now := time.Now()
+			current := make(map[string]portRecord, len(records))
+			for _, record := range records {
+				current[portRecordKey(record)] = record
+			}
+
+			if previous != nil {
+				for _, event := range diffPortRecords(previous, current, now) {
+					changes[portRecordKey(event.portRecord)] = portChange{event: event.Event, at: now, record: event.portRecord}
+					if !redraw {
+						printPortEvent(event)
+					}
+					if portsWatchExec != "" {
+						runPortHook(event)
+					}
+				}
+			}
+			previous = current
+
+			if redraw {
+				for key, change := range changes {
+					if now.Sub(change.at) > portsWatchHighlight {
+						delete(changes, key)
+					}
+				}
+				drawPortsWatch(records, changes, now)
+			}
+		}
+
+		select {
+		case <-interrupt:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// diffPortRecords returns open events for keys only in current and close
+// events for keys only in previous, in a stable order.
+func diffPortRecords(previous, current map[string]portRecord, now time.Time) []portEvent {
+	var events []portEvent
+	for key, record := range current {
+		if _, ok := previous[key]; !ok {
+			events = append(events, portEvent{Time: now, Event: "open", portRecord: record})
+		}
+	}
+	for key, record := range previous {
+		if _, ok := current[key]; !ok {
+			events = append(events, portEvent{Time: now, Event: "close", portRecord: record})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Port != events[j].Port {
+			return events[i].Port < events[j].Port
+		}
+		return portRecordKey(events[i].portRecord) < portRecordKey(events[j].portRecord)
+	})
+	return events
+}
+
+func printPortEvent(event portEvent) {
+	if portsOutput == "json" {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding event: %v\n", err)
+			return
+		}
+		fmt.Println(string(payload))
+		return
+	}
+
+	fmt.Printf("%s %-5s %-5s %-22s pid=%d %s\n",
+		event.Time.Format("15:04:05"), strings.ToUpper(event.Event), event.Protocol, event.LocalAddress, event.PID, event.Name)
+}
+
+// runPortHook runs the --exec command through the shell with the event
+// described in DEVTOOL_* environment variables.
+func runPortHook(event portEvent) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", portsWatchExec)
+	} else {
+		cmd = exec.Command("sh", "-c", portsWatchExec)
+	}
+	cmd.Env = append(os.Environ(),
+		"DEVTOOL_EVENT="+event.Event,
+		"DEVTOOL_PORT="+strconv.FormatUint(uint64(event.Port), 10),
+		"DEVTOOL_PID="+strconv.Itoa(int(event.PID)),
+		"DEVTOOL_PROCESS="+event.Name,
+		"DEVTOOL_PROTOCOL="+event.Protocol,
+		"DEVTOOL_ADDRESS="+event.LocalAddress,
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Hook failed for %s on port %d: %v\n", event.Event, event.Port, err)
+	}
+}
+
+// drawPortsWatch clears the terminal and prints the current listeners,
+// with recently opened ports in green and recently closed ones in red.
+func drawPortsWatch(records []portRecord, changes map[string]portChange, now time.Time) {
+	rows := append([]portRecord(nil), records...)
+	var closed []portRecord
+	for _, change := range changes {
+		if change.event == "close" {
+			closed = append(closed, change.record)
+		}
+	}
+	sort.Slice(closed, func(i, j int) bool { return closed[i].Port < closed[j].Port })
+	rows = append(rows, closed...)
+
+	var table bytes.Buffer
+	writePortsTable(&table, rows)
+	lines := strings.Split(strings.TrimRight(table.String(), "\n"), "\n")
+
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J")
+	fmt.Fprintf(&b, "Every %s: devtool ports    %s\n\n", portsWatchInterval, now.Format("15:04:05"))
+	fmt.Fprintf(&b, "  %s\n", lines[0])
+	for i, line := range lines[1:] {
+		change, changed := changes[portRecordKey(rows[i])]
+		switch {
+		case i >= len(records):
+			fmt.Fprintf(&b, "\033[31m- %s\033[0m\n", line)
+		case changed && change.event == "open":
+			fmt.Fprintf(&b, "\033[32m+ %s\033[0m\n", line)
+		default:
+			fmt.Fprintf(&b, "  %s\n", line)
+		}
+	}
+	fmt.Fprintf(&b, "\n%d listening, %d opened and %d closed in the last %s\n", len(records), countChanges(changes, "open"), len(closed), portsWatchHighlight)
+	fmt.Print(b.String())
+}
+
+func countChanges(changes map[string]portChange, event string) int {
+	count := 0
+	for _, change := range changes {
+		if change.event == event {
+			count++
+		}
+	}
+	return count
+}
+
+func stdoutIsTerminal() bool {
+	stat, err := os.Stdout.Stat()
+	return err == nil && (stat.Mode()&os.ModeCharDevice) != 0
+}
@@ -0,0 +1,288 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var runFile string
+var runRange string
+var runRestart string
+var runGrace time.Duration
+
+var runCmd = &cobra.Command{
+	Use:   "run [process...]",
+	Short: "Run the processes of a Procfile or devtool.yaml",
+	Long: `Starts every process of a Procfile or devtool.yaml (or only the named ones)
+and interleaves their output, each line prefixed with the process name in its
+own colour.
+
+Each process gets a PORT environment variable from the free-port allocator used
+by 'devtool ports free', skipping ports the project declares, unless
+devtool.yaml fixes its port. Crashed processes are restarted with exponential
+backoff (1s up to 30s); --restart sets the policy: on-failure (default),
+always or never.
+
+On Ctrl-C every process tree gets SIGTERM and, after --grace, SIGKILL, just
+like 'devtool kill --tree'. A second Ctrl-C sends SIGKILL right away.
+
+Without --file, devtool.yaml, devtool.yml, Procfile.dev and Procfile are tried
+in that order. A devtool.yaml looks like this:
+
+  processes:
+    web:
+      command: npm run dev -- --port $PORT
+      dir: frontend
+      env:
+        NODE_ENV: development
+    api:
+      command: go run ./cmd/api
+      port: 8080
+      restart: always
+    worker: python worker.py`,
+	Example: `  devtool run
+  devtool run web api
+  devtool run --file Procfile.test --restart never
+  devtool run --range 3000-3999`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !validRestartPolicy(runRestart) {
+			fmt.Printf("Invalid restart policy %q. Must be one of: on-failure, always, never\n", runRestart)
+			os.Exit(1)
+		}
+		start, end, err := parsePortRange(runRange)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		path := runFile
+		if path == "" {
+			path = findRunFile()
+			if path == "" {
+				fmt.Println("Error: no devtool.yaml, devtool.yml, Procfile.dev or Procfile found; use --file")
+				os.Exit(1)
+			}
+		}
+		processes, err := loadRunFile(path)
+		if err != nil {
+			fmt.Printf("Error reading %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		processes, err = selectRunProcesses(processes, args)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := assignRunPorts(processes, filepath.Dir(path), start, end); err != nil {
+			fmt.Printf("Error assigning ports: %v\n", err)
+			os.Exit(1)
+		}
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+		r := newRunner(processes)
+		killLog = r
+		done := r.startAll()
+		select {
+		case <-signals:
+			fmt.Fprintln(r)
+			fmt.Fprintln(r, "Shutting down... (press Ctrl-C again to kill immediately)")
+			stopped := make(chan struct{})
+			go func() {
+				r.shutdown(runGrace)
+				close(stopped)
+			}()
+			select {
+			case <-signals:
+				fmt.Fprintln(r, "Killing all processes...")
+				r.forceShutdown()
+			case <-stopped:
+			}
+			<-stopped
+			<-done
+		case <-done:
+		}
+		if r.failed && !r.stopping {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+	runCmd.Flags().StringVarP(&runFile, "file", "f", "", "Procfile or devtool.yaml to run")
+	runCmd.Flags().StringVarP(&runRange, "range", "r", "20000-40000", "Port range to assign PORT from, as START-END")
+	runCmd.Flags().StringVar(&runRestart, "restart", "on-failure", "Restart policy for crashed processes: on-failure, always or never")
+	runCmd.Flags().DurationVarP(&runGrace, "grace", "g", 5*time.Second, "How long processes get to exit on Ctrl-C before SIGKILL")
+}
+
+// runProcess is one entry of a Procfile or devtool.yaml.
+type runProcess struct {
+	Name    string            `yaml:"-"`
+	Command string            `yaml:"command"`
+	Dir     string            `yaml:"dir"`
+	Port    int               `yaml:"port"`
+	Env     map[string]string `yaml:"env"`
+	Restart string            `yaml:"restart"`
+}
+
+func validRestartPolicy(policy string) bool {
+	return policy == "on-failure" || policy == "always" || policy == "never"
+}
+
+func findRunFile() string {
+	for _, name := range []string{"devtool.yaml", "devtool.yml", "Procfile.dev", "Procfile"} {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// loadRunFile reads a devtool.yaml (by extension) or a Procfile. Relative
+// working directories are resolved against the file's directory.
+func loadRunFile(path string) ([]runProcess, error) {
+	var processes []runProcess
+	var err error
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		processes, err = parseRunYAML(path)
+	} else {
+		processes, err = parseRunProcfile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(processes) == 0 {
+		return nil, fmt.Errorf("no processes defined")
+	}
+
+	base, _ := filepath.Abs(filepath.Dir(path))
+	for i := range processes {
+		if processes[i].Command == "" {
+			return nil, fmt.Errorf("process %q has no command", processes[i].Name)
+		}
+		if processes[i].Restart != "" && !validRestartPolicy(processes[i].Restart) {
+			return nil, fmt.Errorf("process %q has invalid restart policy %q", processes[i].Name, processes[i].Restart)
+		}
+		if !filepath.IsAbs(processes[i].Dir) {
+			processes[i].Dir = filepath.Join(base, processes[i].Dir)
+		}
+	}
+	return processes, nil
+}
+
+func parseRunProcfile(path string) ([]runProcess, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var processes []runProcess
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name, command, ok := strings.Cut(scanner.Text(), ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		processes = append(processes, runProcess{Name: name, Command: strings.TrimSpace(command)})
+	}
+	return processes, scanner.Err()
+}
+
+// parseRunYAML reads the processes map in file order. A process can be a
+// mapping or just its command.
+func parseRunYAML(path string) ([]runProcess, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Processes yaml.MapSlice `yaml:"processes"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	var processes []runProcess
+	for _, item := range file.Processes {
+		process := runProcess{Name: fmt.Sprint(item.Key)}
+		if command, ok := item.Value.(string); ok {
+			process.Command = command
+		} else {
+			raw, _ := yaml.Marshal(item.Value)
+			if err := yaml.Unmarshal(raw, &process); err != nil {
+				return nil, fmt.Errorf("process %q: %v", process.Name, err)
+			}
+			if _, ok := process.Env["PORT"]; ok {
+				return nil, fmt.Errorf("process %q: set a fixed port with port: instead of PORT in env", process.Name)
+			}
+		}
+		processes = append(processes, process)
+	}
+	return processes, nil
+}
+
+// selectRunProcesses keeps the named processes, or all when names is empty.
+func selectRunProcesses(processes []runProcess, names []string) ([]runProcess, error) {
+	if len(names) == 0 {
+		return processes, nil
+	}
+	byName := make(map[string]runProcess, len(processes))
+	for _, process := range processes {
+		byName[process.Name] = process
+	}
+	var selected []runProcess
+	for _, name := range names {
+		process, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("no process named %q", name)
+		}
+		selected = append(selected, process)
+	}
+	return selected, nil
+}
+
+// assignRunPorts gives every process without a fixed port a free one,
+// avoiding the fixed ports and the ports the project in dir declares.
+func assignRunPorts(processes []runProcess, dir string, start, end int) error {
+	avoid := make(map[int]bool)
+	if declared, err := findProjectPorts(dir); err == nil {
+		for _, port := range declared {
+			avoid[port.Port] = true
+		}
+	}
+	needed := 0
+	for _, process := range processes {
+		if process.Port != 0 {
+			avoid[process.Port] = true
+		} else {
+			needed++
+		}
+	}
+	if needed == 0 {
+		return nil
+	}
+
+	ports, err := findFreePorts(needed, start, end, avoid, 0)
+	if err != nil {
+		return err
+	}
+	for i := range processes {
+		if processes[i].Port == 0 {
+			processes[i].Port, ports = ports[0], ports[1:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// runColors are the ANSI colours cycled through for process prefixes.
+var runColors = []string{"36", "33", "32", "35", "34", "31"}
+
+const (
+	runBackoffStart = time.Second
+	runBackoffMax   = 30 * time.Second
+	// runHealthyAfter resets the backoff for processes that ran this long.
+	runHealthyAfter = 30 * time.Second
+)
+
+// runner starts the processes, restarts them by policy and stops them all
+// on shutdown.
+type runner struct {
+	processes []runProcess
+	width     int
+	color     bool
+
+	output sync.Mutex // serialises lines written to stdout
+
+	mu       sync.Mutex // guards running, stopping, failed and targets
+	running  map[int]*exec.Cmd
+	stopping bool
+	failed   bool
+	targets  []killTarget
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newRunner(processes []runProcess) *runner {
+	r := &runner{
+		processes: processes,
+		color:     stdoutIsTerminal(),
+		running:   make(map[int]*exec.Cmd),
+		stop:      make(chan struct{}),
+	}
+	for _, entry := range processes {
+		if len(entry.Name) > r.width {
+			r.width = len(entry.Name)
+		}
+	}
+	return r
+}
+
+// startAll supervises every process and returns a channel closed once all
+// of them have ended for good.
+func (r *runner) startAll() <-chan struct{} {
+	for i := range r.processes {
+		r.wg.Add(1)
+		go r.supervise(i)
+	}
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+func (r *runner) supervise(index int) {
+	defer r.wg.Done()
+	entry := r.processes[index]
+	policy := entry.Restart
+	if policy == "" {
+		policy = runRestart
+	}
+
+	backoff := runBackoffStart
+	for {
+		started := time.Now()
+		cmd, output, err := r.start(index)
+		if err != nil {
+			r.logf(index, "failed to start: %v", err)
+			r.setFailed()
+			return
+		}
+		if cmd == nil {
+			return // shutting down
+		}
+		r.logf(index, "started with pid %d (PORT=%d)", cmd.Process.Pid, entry.Port)
+
+		err = cmd.Wait()
+		// Let the output reader catch up, unless a background child keeps the pipe open.
+		select {
+		case <-output:
+		case <-time.After(500 * time.Millisecond):
+		}
+		r.mu.Lock()
+		delete(r.running, index)
+		stopping := r.stopping
+		r.mu.Unlock()
+
+		code := 0
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			code = exitErr.ExitCode()
+		} else if err != nil {
+			code = -1
+		}
+		if stopping {
+			r.logf(index, "stopped")
+			return
+		}
+		if code == 0 {
+			r.logf(index, "exited")
+		} else {
+			r.logf(index, "exited with code %d", code)
+			r.setFailed()
+		}
+		if policy == "never" || (policy == "on-failure" && code == 0) {
+			return
+		}
+
+		if time.Since(started) >= runHealthyAfter {
+			backoff = runBackoffStart
+		}
+		r.logf(index, "restarting in %s", backoff)
+		select {
+		case <-r.stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > runBackoffMax {
+			backoff = runBackoffMax
+		}
+	}
+}
+
+// start launches a process through the shell with PORT and its env set,
+// and streams its output. It returns a nil command during shutdown.
+func (r *runner) start(index int) (*exec.Cmd, <-chan struct{}, error) {
+	entry := r.processes[index]
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", entry.Command)
+	} else {
+		cmd = exec.Command("sh", "-c", entry.Command)
+	}
+	cmd.Dir = entry.Dir
+	cmd.Env = append(os.Environ(), "PORT="+strconv.Itoa(entry.Port))
+	for name, value := range entry.Env {
+		cmd.Env = append(cmd.Env, name+"="+value)
+	}
+	detachFromTerminalSignals(cmd)
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	r.mu.Lock()
+	if r.stopping {
+		r.mu.Unlock()
+		reader.Close()
+		writer.Close()
+		return nil, nil, nil
+	}
+	err = cmd.Start()
+	if err == nil {
+		r.running[index] = cmd
+	}
+	r.mu.Unlock()
+	writer.Close()
+	if err != nil {
+		reader.Close()
+		return nil, nil, err
+	}
+
+	output := make(chan struct{})
+	go func() {
+		defer close(output)
+		defer reader.Close()
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			r.print(index, scanner.Text())
+		}
+	}()
+	return cmd, output, nil
+}
+
+func (r *runner) setFailed() {
+	r.mu.Lock()
+	r.failed = true
+	r.mu.Unlock()
+}
+
+func (r *runner) logf(index int, format string, args ...interface{}) {
+	r.print(index, fmt.Sprintf(format, args...))
+}
+
+// print writes one line as "15:04:05 web    | text", with the prefix in the
+// process's colour on a terminal.
+func (r *runner) print(index int, line string) {
+	prefix := fmt.Sprintf("%s %-*s |", time.Now().Format("15:04:05"), r.width, r.processes[index].Name)
+	if r.color {
+		prefix = "\033[" + runColors[index%len(runColors)] + "m" + prefix + "\033[0m"
+	}
+	r.output.Lock()
+	defer r.output.Unlock()
+	fmt.Println(prefix + " " + line)
+}
+
+// Write lets shutdown progress from terminateProcesses share stdout with
+// the process output without splitting lines.
+func (r *runner) Write(p []byte) (int, error) {
+	r.output.Lock()
+	defer r.output.Unlock()
+	return os.Stdout.Write(p)
+}
+
+// shutdown stops restarts and terminates every running process tree with
+// SIGTERM, escalating to SIGKILL after grace, as devtool kill --tree does.
+func (r *runner) shutdown(grace time.Duration) {
+	r.mu.Lock()
+	r.stopping = true
+	close(r.stop)
+	r.mu.Unlock()
+
+	targets, err := r.runningTrees()
+	if err != nil {
+		fmt.Fprintf(r, "Error: %v\n", err)
+		return
+	}
+	r.mu.Lock()
+	r.targets = targets
+	r.mu.Unlock()
+	if len(targets) > 0 {
+		terminateProcesses(targets, syscall.SIGTERM, grace)
+	}
+}
+
+// forceShutdown kills the process trees with SIGKILL right away, for a
+// second Ctrl-C during shutdown.
+func (r *runner) forceShutdown() {
+	r.mu.Lock()
+	targets := r.targets
+	r.mu.Unlock()
+	if targets == nil {
+		var err error
+		if targets, err = r.runningTrees(); err != nil {
+			fmt.Fprintf(r, "Error: %v\n", err)
+			return
+		}
+	}
+	var alive []killTarget
+	for _, target := range targets {
+		if proc, err := process.NewProcess(target.PID); err == nil && !processExited(proc) {
+			alive = append(alive, target)
+		}
+	}
+	if len(alive) > 0 {
+		terminateProcesses(alive, syscall.SIGKILL, 0)
+	}
+}
+
+// runningTrees finds the running processes and all their descendants.
+func (r *runner) runningTrees() ([]killTarget, error) {
+	r.mu.Lock()
+	var pids []int32
+	for _, cmd := range r.running {
+		pids = append(pids, int32(cmd.Process.Pid))
+	}
+	r.mu.Unlock()
+	if len(pids) == 0 {
+		return nil, nil
+	}
+	return killSelection{PIDs: pids, Tree: true}.find()
+}
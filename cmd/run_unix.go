@@ -0,0 +1,15 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachFromTerminalSignals puts the process in its own process group so
+// that Ctrl-C only reaches devtool, which then shuts everything down in
+// order.
+func detachFromTerminalSignals(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
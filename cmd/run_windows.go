@@ -0,0 +1,7 @@
+package cmd
+
+import "os/exec"
+
+// detachFromTerminalSignals is a no-op on Windows, where Ctrl-C reaches the
+// whole console and processes are terminated rather than signalled.
+func detachFromTerminalSignals(cmd *exec.Cmd) {}
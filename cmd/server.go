@@ -6,14 +6,12 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"io"
 	"log"
 	"math/big"
 	"net/http"
-	"sort"
 	"strings"
 	"time"
 
@@ -27,6 +25,7 @@ var serverBody string
 var serverHeaders []string
 var serverDelay time.Duration
 var serverLogBodyLimit int
+var serverLogFormat string
 
 // serverCmd represents the server command
 var serverCmd = &cobra.Command{
@@ -40,13 +39,22 @@ By default, every request receives an HTTP 200 OK response
 with a JSON body: {"status": "ok"}.
 
 You can customize the response status, body, headers, delay,
-and request body log size with flags.`,
+and request body log size with flags.
+
+Requests are logged as one JSON object per line by default. Use
+--log-format to choose another format:
+  json    One compact JSON object per line
+  pretty  Colourised, indented view with the body formatted by content type
+  curl    A ready-to-paste curl command that reproduces the request
+  har     One HAR 1.2 entry per line`,
 	Example: `  devtool server
   devtool server --port 9090
   devtool server --ssl
   devtool server --status 201 --body '{"ok":true}'
   devtool server --header 'Content-Type: application/json' --header 'X-Debug: true'
-  devtool server --delay 250ms --log-body-limit 8192`,
+  devtool server --delay 250ms --log-body-limit 8192
+  devtool server --log-format pretty
+  devtool server --log-format curl`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if serverStatus < 100 || serverStatus > 999 {
 			log.Fatalf("Invalid status code %d. Must be between 100 and 999.", serverStatus)
@@ -54,6 +62,9 @@ and request body log size with flags.`,
 		if serverLogBodyLimit < 0 {
 			log.Fatalf("Invalid log body limit %d. Must be zero or greater.", serverLogBodyLimit)
 		}
+		if !validRequestLogFormat(serverLogFormat) {
+			log.Fatalf("Invalid log format %q. Must be one of: %s.", serverLogFormat, strings.Join(requestLogFormats, ", "))
+		}
 
 		responseHeaders, err := parseResponseHeaders(serverHeaders)
 		if err != nil {
@@ -87,7 +98,7 @@ and request body log size with flags.`,
 			w.WriteHeader(serverStatus)
 			fmt.Fprintln(w, responseBody)
 		})
-		handler := requestLogger(catchAll, serverLogBodyLimit)
+		handler := requestLogger(catchAll, serverLogBodyLimit, serverLogFormat)
 
 		addr := fmt.Sprintf(":%d", serverPort)
 
@@ -132,6 +143,7 @@ func init() {
 	serverCmd.Flags().StringArrayVar(&serverHeaders, "header", nil, "Response header in 'Key: Value' format; may be repeated")
 	serverCmd.Flags().DurationVar(&serverDelay, "delay", 0, "Delay before sending the response (for example 250ms, 2s)")
 	serverCmd.Flags().IntVar(&serverLogBodyLimit, "log-body-limit", 64*1024, "Maximum number of request body bytes to capture in logs")
+	serverCmd.Flags().StringVar(&serverLogFormat, "log-format", "json", "Request log format: json, pretty, curl or har")
 }
 
 func generateSelfSignedCert() ([]byte, []byte, error) {
@@ -213,7 +225,7 @@ func (b *bodyCaptureReadCloser) Close() error {
 	return b.body.Close()
 }
 
-func requestLogger(next http.Handler, bodyLimit int) http.Handler {
+func requestLogger(next http.Handler, bodyLimit int, format string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		bodyCapture := &bodyCaptureReadCloser{
 			body:  r.Body,
@@ -221,47 +233,38 @@ func requestLogger(next http.Handler, bodyLimit int) http.Handler {
 		}
 		r.Body = bodyCapture
 
-		headers := make(map[string]string, len(r.Header))
-		keys := make([]string, 0, len(r.Header))
-		for key := range r.Header {
-			keys = append(keys, key)
-		}
-		sort.Strings(keys)
-		for _, key := range keys {
-			headers[key] = strings.Join(r.Header.Values(key), ", ")
-		}
-
-		logData := map[string]any{
-			"timestamp":   time.Now().Format(time.RFC3339),
-			"remote_addr": r.RemoteAddr,
-			"method":      r.Method,
-			"url":         r.URL.String(),
-			"proto":       r.Proto,
-			"host":        r.Host,
-			"headers":     headers,
+		entry := &requestLogEntry{
+			Time:       time.Now(),
+			RemoteAddr: r.RemoteAddr,
+			Method:     r.Method,
+			URL:        r.URL.String(),
+			Proto:      r.Proto,
+			Host:       r.Host,
+			TLS:        r.TLS != nil,
+			Headers:    r.Header.Clone(),
 		}
 
 		lrw := &loggingResponseWriter{ResponseWriter: w}
-		start := time.Now()
 		next.ServeHTTP(lrw, r)
 		if lrw.status == 0 {
 			lrw.status = http.StatusOK
 		}
 
-		logData["status"] = lrw.status
-		logData["response_bytes"] = lrw.bytes
-		logData["duration_ms"] = time.Since(start).Milliseconds()
-		logData["body"] = bodyCapture.buf.String()
-		if bodyCapture.truncated {
-			logData["body_truncated"] = true
-		}
+		entry.Status = lrw.status
+		entry.ResponseBytes = lrw.bytes
+		entry.ResponseHeaders = lrw.Header().Clone()
+		entry.Duration = time.Since(entry.Time)
 
-		payload, marshalErr := json.Marshal(logData)
-		if marshalErr != nil {
-			log.Printf("Failed to marshal request log: %v", marshalErr)
-			return
+		// The pretty, curl and HAR formats show or replay the body, so pull
+		// it through the capture even when the handler (like the catch-all)
+		// never read it. The json format keeps logging only what was read.
+		if bodyLimit > 0 && format != "json" {
+			_, _ = io.Copy(io.Discard, io.LimitReader(bodyCapture, int64(bodyLimit)+1))
 		}
-		log.Println(string(payload))
+		entry.Body = bodyCapture.buf.String()
+		entry.BodyTruncated = bodyCapture.truncated
+
+		writeRequestLog(entry, format)
 	})
 }
 
@@ -0,0 +1,714 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var dnsPort int
+var dnsZoneFile string
+var dnsForward string
+var dnsDefaultTTL uint32
+
+// serverDNSCmd represents the server dns command
+var serverDNSCmd = &cobra.Command{
+	Use:   "dns",
+	Short: "Start a DNS stub server that answers from a zone file",
+	Long: `Start a DNS server for development hostnames that answers A, AAAA,
+CNAME, TXT and SRV queries from a zone-style file, over both UDP and TCP.
+
+Names inside a zone's $ORIGIN that have no records get NXDOMAIN. Queries for
+any other name are refused, or passed to an upstream resolver when --forward
+is given, so the server runs fully offline by default. Every query is logged
+as one JSON object per line.
+
+Zone file format (one record per line, ';' starts a comment):
+  $ORIGIN dev.test.
+  $TTL 60
+  @              A      127.0.0.1
+  api            A      127.0.0.1
+  api     300    AAAA   ::1
+  www            CNAME  api
+  *.apps         A      10.0.0.5
+  @              TXT    "v=spf1 -all" "second string"
+  _http._tcp     SRV    10 5 8080 api
+  db.other.test. A      192.168.1.20
+
+Names without a trailing dot are relative to $ORIGIN, '@' is the origin
+itself, and a leading '*' label matches any name below it.`,
+	Example: `  devtool server dns --zone dev.zone
+  devtool server dns --zone dev.zone --port 5300
+  devtool server dns --zone dev.zone --forward 1.1.1.1:53
+  dig @127.0.0.1 -p 1053 api.dev.test`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if dnsZoneFile == "" {
+			fmt.Println("Error: --zone is required")
+			_ = cmd.Help()
+			os.Exit(1)
+		}
+
+		zone, err := loadDNSZone(dnsZoneFile, dnsDefaultTTL)
+		if err != nil {
+			log.Fatalf("Failed to load zone file: %v", err)
+		}
+
+		forward := dnsForward
+		if forward != "" {
+			if _, _, err := net.SplitHostPort(forward); err != nil {
+				forward = net.JoinHostPort(forward, "53")
+			}
+		}
+
+		server := &dnsServer{zone: zone, forward: forward}
+		addr := fmt.Sprintf(":%d", dnsPort)
+
+		udpConn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			log.Fatalf("Failed to listen on UDP: %v", err)
+		}
+		tcpListener, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatalf("Failed to listen on TCP: %v", err)
+		}
+
+		upstream := "refusing other names"
+		if forward != "" {
+			upstream = "forwarding other names to " + forward
+		}
+		fmt.Printf("DNS listening at localhost:%d (udp+tcp) — %d records loaded, %s\n", dnsPort, zone.count, upstream)
+
+		go server.serveTCP(tcpListener)
+		server.serveUDP(udpConn)
+	},
+}
+
+func init() {
+	serverCmd.AddCommand(serverDNSCmd)
+	serverDNSCmd.Flags().IntVarP(&dnsPort, "port", "p", 1053, "Port to listen on (UDP and TCP)")
+	serverDNSCmd.Flags().StringVarP(&dnsZoneFile, "zone", "z", "", "Zone file with the records to serve")
+	serverDNSCmd.Flags().StringVar(&dnsForward, "forward", "", "Upstream resolver for names outside the zone (default: refuse them)")
+	serverDNSCmd.Flags().Uint32Var(&dnsDefaultTTL, "ttl", 60, "TTL for records that do not set one and have no $TTL")
+}
+
+type dnsRecord struct {
+	name  string
+	rtype dnsmessage.Type
+	ttl   uint32
+	value string
+	body  dnsmessage.ResourceBody
+}
+
+type dnsZone struct {
+	records map[string][]dnsRecord
+	origins []string
+	count   int
+}
+
+// loadDNSZone parses a small subset of the RFC 1035 master file format:
+// $ORIGIN and $TTL directives plus single-line A, AAAA, CNAME, TXT and SRV
+// records with an optional TTL and IN class.
+func loadDNSZone(path string, defaultTTL uint32) (*dnsZone, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	zone := &dnsZone{records: make(map[string][]dnsRecord)}
+	origin := "."
+	ttl := defaultTTL
+	lastName := ""
+
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		raw := scanner.Text()
+		fields, err := splitZoneLine(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "$ORIGIN":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: $ORIGIN needs exactly one name", lineNo)
+			}
+			origin = absoluteDNSName(fields[1], ".")
+			zone.origins = append(zone.origins, origin)
+			continue
+		case "$TTL":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: $TTL needs exactly one value", lineNo)
+			}
+			value, err := strconv.ParseUint(fields[1], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid $TTL %q", lineNo, fields[1])
+			}
+			ttl = uint32(value)
+			continue
+		}
+
+		// A line starting with whitespace reuses the previous owner name.
+		var name string
+		if raw[0] == ' ' || raw[0] == '\t' {
+			if lastName == "" {
+				return nil, fmt.Errorf("line %d: record has no owner name", lineNo)
+			}
+			name = lastName
+		} else {
+			name = absoluteDNSName(fields[0], origin)
+			fields = fields[1:]
+		}
+		lastName = name
+
+		recordTTL := ttl
+		if len(fields) > 0 {
+			if value, err := strconv.ParseUint(fields[0], 10, 32); err == nil {
+				recordTTL = uint32(value)
+				fields = fields[1:]
+			}
+		}
+		if len(fields) > 0 && strings.EqualFold(fields[0], "IN") {
+			fields = fields[1:]
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected a record type and data", lineNo)
+		}
+
+		record, err := parseDNSRecord(name, strings.ToUpper(fields[0]), fields[1:], origin)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		record.ttl = recordTTL
+		zone.records[name] = append(zone.records[name], record)
+		zone.count++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return zone, nil
+}
+
+func parseDNSRecord(name, rtype string, data []string, origin string) (dnsRecord, error) {
+	record := dnsRecord{name: name, value: strings.Join(data, " ")}
+
+	switch rtype {
+	case "A":
+		ip := net.ParseIP(data[0]).To4()
+		if ip == nil || len(data) != 1 {
+			return record, fmt.Errorf("invalid A record data %q", record.value)
+		}
+		body := &dnsmessage.AResource{}
+		copy(body.A[:], ip)
+		record.rtype, record.body = dnsmessage.TypeA, body
+	case "AAAA":
+		ip := net.ParseIP(data[0])
+		if ip == nil || ip.To4() != nil || len(data) != 1 {
+			return record, fmt.Errorf("invalid AAAA record data %q", record.value)
+		}
+		body := &dnsmessage.AAAAResource{}
+		copy(body.AAAA[:], ip.To16())
+		record.rtype, record.body = dnsmessage.TypeAAAA, body
+	case "CNAME":
+		if len(data) != 1 {
+			return record, fmt.Errorf("invalid CNAME record data %q", record.value)
+		}
+		target, err := dnsmessage.NewName(absoluteDNSName(data[0], origin))
+		if err != nil {
+			return record, err
+		}
+		record.value = target.String()
+		record.rtype, record.body = dnsmessage.TypeCNAME, &dnsmessage.CNAMEResource{CNAME: target}
+	case "TXT":
+		for _, value := range data {
+			if len(value) > 255 {
+				return record, fmt.Errorf("TXT string longer than 255 bytes")
+			}
+		}
+		quoted := make([]string, len(data))
+		for i, value := range data {
+			quoted[i] = strconv.Quote(value)
+		}
+		record.value = strings.Join(quoted, " ")
+		record.rtype, record.body = dnsmessage.TypeTXT, &dnsmessage.TXTResource{TXT: data}
+	case "SRV":
+		if len(data) != 4 {
+			return record, fmt.Errorf("SRV record needs priority, weight, port and target")
+		}
+		var numbers [3]uint16
+		for i := range numbers {
+			value, err := strconv.ParseUint(data[i], 10, 16)
+			if err != nil {
+				return record, fmt.Errorf("invalid SRV field %q", data[i])
+			}
+			numbers[i] = uint16(value)
+		}
+		target, err := dnsmessage.NewName(absoluteDNSName(data[3], origin))
+		if err != nil {
+			return record, err
+		}
+		record.value = fmt.Sprintf("%d %d %d %s", numbers[0], numbers[1], numbers[2], target)
+		record.rtype, record.body = dnsmessage.TypeSRV, &dnsmessage.SRVResource{
+			Priority: numbers[0],
+			Weight:   numbers[1],
+			Port:     numbers[2],
+			Target:   target,
+		}
+	default:
+		return record, fmt.Errorf("unsupported record type %q", rtype)
+	}
+
+	return record, nil
+}
+
+// splitZoneLine splits a zone file line into fields, keeping quoted strings
+// together and dropping comments.
+func splitZoneLine(line string) ([]string, error) {
+	var fields []string
+	var current strings.Builder
+	inQuotes := false
+	hasField := false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inQuotes && c == '\\' && i+1 < len(line):
+			i++
+			current.WriteByte(line[i])
+		case c == '"':
+			inQuotes = !inQuotes
+			hasField = true
+		case inQuotes:
+			current.WriteByte(c)
+		case c == ';' || (c == '#' && !hasField && len(fields) == 0):
+			i = len(line)
+		case c == ' ' || c == '\t':
+			if hasField {
+				fields = append(fields, current.String())
+				current.Reset()
+				hasField = false
+			}
+		default:
+			current.WriteByte(c)
+			hasField = true
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quoted string")
+	}
+	if hasField {
+		fields = append(fields, current.String())
+	}
+	return fields, nil
+}
+
+func absoluteDNSName(name, origin string) string {
+	name = strings.ToLower(name)
+	origin = strings.ToLower(origin)
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return name
+	case origin == ".":
+		return name + "."
+	default:
+		return name + "." + origin
+	}
+}
+
+// lookup returns the records for name, falling back to the closest
+// wildcard ("*.parent.") when the name itself has none.
+func (z *dnsZone) lookup(name string) ([]dnsRecord, bool) {
+	if records, ok := z.records[name]; ok {
+		return records, true
+	}
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	for i := 1; i < len(labels); i++ {
+		wildcard := "*." + strings.Join(labels[i:], ".") + "."
+		if records, ok := z.records[wildcard]; ok {
+			return records, true
+		}
+	}
+	return nil, false
+}
+
+func (z *dnsZone) authoritative(name string) bool {
+	for _, origin := range z.origins {
+		if origin != "." && (name == origin || strings.HasSuffix(name, "."+origin)) {
+			return true
+		}
+	}
+	return false
+}
+
+type dnsServer struct {
+	zone    *dnsZone
+	forward string
+}
+
+func (s *dnsServer) serveUDP(conn net.PacketConn) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			log.Printf("Failed to read UDP query: %v", err)
+			continue
+		}
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			response := s.handle(query, addr.String(), "udp")
+			if response != nil {
+				_, _ = conn.WriteTo(response, addr)
+			}
+		}()
+	}
+}
+
+func (s *dnsServer) serveTCP(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Printf("Failed to accept TCP connection: %v", err)
+			continue
+		}
+		go func() {
+			defer conn.Close()
+			for {
+				_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+				query, err := readTCPDNSMessage(conn)
+				if err != nil {
+					return
+				}
+				response := s.handle(query, conn.RemoteAddr().String(), "tcp")
+				if response == nil {
+					return
+				}
+				if err := writeTCPDNSMessage(conn, response); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func readTCPDNSMessage(r io.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, length)
+	_, err := io.ReadFull(r, msg)
+	return msg, err
+}
+
+func writeTCPDNSMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	copy(buf[2:], msg)
+	_, err := w.Write(buf)
+	return err
+}
+
+func (s *dnsServer) handle(query []byte, remoteAddr, proto string) []byte {
+	start := time.Now()
+
+	logData := map[string]any{
+		"timestamp":   time.Now().Format(time.RFC3339),
+		"remote_addr": remoteAddr,
+		"proto":       proto,
+	}
+
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		logData["error"] = fmt.Sprintf("ignoring malformed query: %v", err)
+		logDNSQuery(logData, start)
+		return nil
+	}
+	question, err := parser.Question()
+	if err != nil {
+		logData["error"] = fmt.Sprintf("malformed question: %v", err)
+		logData["rcode"] = strings.TrimPrefix(dnsmessage.RCodeFormatError.String(), "RCode")
+		logDNSQuery(logData, start)
+		response, _ := s.reply(header, nil, dnsmessage.RCodeFormatError, nil, proto, 0)
+		return response
+	}
+	ednsSize := queryEDNSSize(&parser)
+
+	name := strings.ToLower(question.Name.String())
+	logData["name"] = name
+	logData["type"] = strings.TrimPrefix(question.Type.String(), "Type")
+
+	var response []byte
+	var answers []dnsRecord
+	rcode := dnsmessage.RCodeSuccess
+
+	switch {
+	case question.Class != dnsmessage.ClassINET:
+		rcode = dnsmessage.RCodeNotImplemented
+		logData["source"] = "zone"
+	case s.zoneHas(name):
+		answers, rcode = s.resolve(name, question.Type)
+		logData["source"] = "zone"
+	case s.forward != "":
+		logData["source"] = "forward"
+		response, err = forwardDNSQuery(s.forward, proto, query)
+		if err != nil {
+			logData["error"] = err.Error()
+			rcode = dnsmessage.RCodeServerFailure
+		} else {
+			var respParser dnsmessage.Parser
+			if respHeader, err := respParser.Start(response); err == nil {
+				rcode = respHeader.RCode
+			}
+		}
+	default:
+		rcode = dnsmessage.RCodeRefused
+		logData["source"] = "refused"
+	}
+
+	// Log the answers actually sent, which is fewer when truncated.
+	if response == nil {
+		response, answers = s.reply(header, &question, rcode, answers, proto, ednsSize)
+	}
+
+	values := make([]string, 0, len(answers))
+	for _, answer := range answers {
+		values = append(values, fmt.Sprintf("%s %d %s %s", answer.name, answer.ttl, strings.TrimPrefix(answer.rtype.String(), "Type"), answer.value))
+	}
+	logData["rcode"] = strings.TrimPrefix(rcode.String(), "RCode")
+	logData["answers"] = values
+	if responseTruncated(response) {
+		logData["truncated"] = true
+	}
+	logDNSQuery(logData, start)
+
+	return response
+}
+
+func logDNSQuery(logData map[string]any, start time.Time) {
+	logData["duration_ms"] = time.Since(start).Milliseconds()
+	payload, err := json.Marshal(logData)
+	if err != nil {
+		log.Printf("Failed to marshal query log: %v", err)
+		return
+	}
+	log.Println(string(payload))
+}
+
+// queryEDNSSize returns the UDP payload size a query advertises in its EDNS
+// OPT record, or 0 when it has none. parser must be past the question.
+func queryEDNSSize(parser *dnsmessage.Parser) uint16 {
+	if parser.SkipAllQuestions() != nil || parser.SkipAllAnswers() != nil || parser.SkipAllAuthorities() != nil {
+		return 0
+	}
+	for {
+		header, err := parser.AdditionalHeader()
+		if err != nil {
+			return 0
+		}
+		if header.Type == dnsmessage.TypeOPT {
+			return uint16(header.Class)
+		}
+		if err := parser.SkipAdditional(); err != nil {
+			return 0
+		}
+	}
+}
+
+func responseTruncated(response []byte) bool {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(response)
+	return err == nil && header.Truncated
+}
+
+func (s *dnsServer) zoneHas(name string) bool {
+	if _, ok := s.zone.lookup(name); ok {
+		return true
+	}
+	return s.zone.authoritative(name)
+}
+
+// resolve answers a query from the zone, following CNAME chains that stay
+// inside the zone.
+func (s *dnsServer) resolve(name string, qtype dnsmessage.Type) ([]dnsRecord, dnsmessage.RCode) {
+	var answers []dnsRecord
+	current := name
+
+	for hops := 0; hops < 8; hops++ {
+		records, ok := s.zone.lookup(current)
+		if !ok {
+			if len(answers) == 0 {
+				return nil, dnsmessage.RCodeNameError
+			}
+			return answers, dnsmessage.RCodeSuccess
+		}
+
+		var cname *dnsRecord
+		matched := false
+		for i := range records {
+			record := records[i]
+			record.name = current
+			if record.rtype == qtype || qtype == dnsmessage.TypeALL {
+				answers = append(answers, record)
+				matched = true
+			} else if record.rtype == dnsmessage.TypeCNAME {
+				cname = &record
+			}
+		}
+		if matched || cname == nil {
+			return answers, dnsmessage.RCodeSuccess
+		}
+
+		answers = append(answers, *cname)
+		current = cname.body.(*dnsmessage.CNAMEResource).CNAME.String()
+	}
+
+	return answers, dnsmessage.RCodeSuccess
+}
+
+// dnsMaxUDPSize caps the EDNS payload size honoured for UDP answers.
+const dnsMaxUDPSize = 4096
+
+// reply builds the response and returns the answers it holds. UDP answers
+// that do not fit in 512 bytes, or the size the client advertised with EDNS,
+// are cut short and marked truncated so that the client retries over TCP.
+func (s *dnsServer) reply(query dnsmessage.Header, question *dnsmessage.Question, rcode dnsmessage.RCode, answers []dnsRecord, proto string, ednsSize uint16) ([]byte, []dnsRecord) {
+	limit := 0
+	if proto == "udp" {
+		limit = 512
+		if ednsSize > 512 {
+			limit = min(int(ednsSize), dnsMaxUDPSize)
+		}
+	}
+
+	msg := s.buildReply(query, question, rcode, answers, ednsSize, false)
+	if limit == 0 || len(msg) <= limit {
+		return msg, answers
+	}
+	keep := len(answers)
+	for keep > 0 {
+		keep--
+		msg = s.buildReply(query, question, rcode, answers[:keep], ednsSize, true)
+		if msg == nil || len(msg) <= limit {
+			break
+		}
+	}
+	return msg, answers[:keep]
+}
+
+func (s *dnsServer) buildReply(query dnsmessage.Header, question *dnsmessage.Question, rcode dnsmessage.RCode, answers []dnsRecord, ednsSize uint16, truncated bool) []byte {
+	header := dnsmessage.Header{
+		ID:                 query.ID,
+		Response:           true,
+		OpCode:             query.OpCode,
+		Authoritative:      rcode != dnsmessage.RCodeRefused,
+		Truncated:          truncated,
+		RecursionDesired:   query.RecursionDesired,
+		RecursionAvailable: s.forward != "",
+		RCode:              rcode,
+	}
+
+	builder := dnsmessage.NewBuilder(make([]byte, 0, 512), header)
+	builder.EnableCompression()
+	if question != nil {
+		if err := builder.StartQuestions(); err != nil {
+			return nil
+		}
+		if err := builder.Question(*question); err != nil {
+			return nil
+		}
+	}
+	if err := builder.StartAnswers(); err != nil {
+		return nil
+	}
+
+	for _, answer := range answers {
+		name, err := dnsmessage.NewName(answer.name)
+		if err != nil {
+			continue
+		}
+		rh := dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: answer.ttl}
+
+		switch body := answer.body.(type) {
+		case *dnsmessage.AResource:
+			err = builder.AResource(rh, *body)
+		case *dnsmessage.AAAAResource:
+			err = builder.AAAAResource(rh, *body)
+		case *dnsmessage.CNAMEResource:
+			err = builder.CNAMEResource(rh, *body)
+		case *dnsmessage.TXTResource:
+			err = builder.TXTResource(rh, *body)
+		case *dnsmessage.SRVResource:
+			err = builder.SRVResource(rh, *body)
+		}
+		if err != nil {
+			log.Printf("Failed to encode %s answer: %v", answer.name, err)
+		}
+	}
+
+	// Answer EDNS queries with an OPT record of our own, as RFC 6891 asks.
+	if ednsSize > 0 {
+		if err := builder.StartAdditionals(); err != nil {
+			return nil
+		}
+		var rh dnsmessage.ResourceHeader
+		if err := rh.SetEDNS0(dnsMaxUDPSize, dnsmessage.RCodeSuccess, false); err != nil {
+			return nil
+		}
+		if err := builder.OPTResource(rh, dnsmessage.OPTResource{}); err != nil {
+			return nil
+		}
+	}
+
+	msg, err := builder.Finish()
+	if err != nil {
+		log.Printf("Failed to build response: %v", err)
+		return nil
+	}
+	return msg
+}
+
+func forwardDNSQuery(upstream, proto string, query []byte) ([]byte, error) {
+	conn, err := net.DialTimeout(proto, upstream, 3*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if proto == "tcp" {
+		if err := writeTCPDNSMessage(conn, query); err != nil {
+			return nil, err
+		}
+		return readTCPDNSMessage(conn)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
@@ -0,0 +1,453 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var grpcPort int
+var grpcProtoFiles []string
+var grpcImportPaths []string
+var grpcDescriptorSet string
+var grpcResponsesFile string
+var grpcDelay time.Duration
+
+// serverGRPCCmd represents the server grpc command
+var serverGRPCCmd = &cobra.Command{
+	Use:   "grpc",
+	Short: "Start a gRPC mock server from .proto files or a descriptor set",
+	Long: `Start a gRPC server that registers every service found in the given
+.proto files (or a FileDescriptorSet produced by protoc --descriptor_set_out)
+and answers every method with a configured or default-valued response.
+
+Server reflection is enabled, so tools like grpcurl and Postman can list
+and call the services without local copies of the protos.
+
+Responses are configured with a JSON file keyed by "package.Service/Method".
+Messages use the protobuf JSON mapping:
+  {
+    "greeter.Greeter/SayHello": {"response": {"message": "Hello!"}},
+    "greeter.Greeter/ListGreetings": {"responses": [{"message": "a"}, {"message": "b"}]},
+    "greeter.Greeter/Delete": {"code": "PERMISSION_DENIED", "message": "not allowed"},
+    "greeter.Greeter/Slow": {"response": {}, "delay": "2s"}
+  }
+
+Methods without an entry return an empty message with status OK.
+Server-streaming methods send every entry in "responses" (or the single
+"response"). Bidirectional methods answer each request message with the
+next configured response, cycling through the list.
+
+Every call is logged as one JSON object per line with the decoded request
+messages, metadata, status code and duration.`,
+	Example: `  devtool server grpc --proto greeter.proto
+  devtool server grpc --proto api/v1/service.proto --import-path ./proto
+  devtool server grpc --descriptor-set service.pb --responses mocks.json
+  grpcurl -plaintext localhost:50051 list`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(grpcProtoFiles) == 0 && grpcDescriptorSet == "" {
+			fmt.Println("Error: must specify --proto or --descriptor-set")
+			_ = cmd.Help()
+			os.Exit(1)
+		}
+
+		files, err := loadGRPCDescriptors(grpcProtoFiles, grpcImportPaths, grpcDescriptorSet)
+		if err != nil {
+			log.Fatalf("Failed to load descriptors: %v", err)
+		}
+
+		responses := map[string]grpcMockResponse{}
+		if grpcResponsesFile != "" {
+			responses, err = loadGRPCResponses(grpcResponsesFile)
+			if err != nil {
+				log.Fatalf("Failed to load responses: %v", err)
+			}
+		}
+
+		mock := newGRPCMock(files, responses, grpcDelay)
+		if len(mock.methods) == 0 {
+			log.Fatalf("No services found in the given descriptors")
+		}
+		for name := range responses {
+			if _, ok := mock.methods["/"+name]; !ok {
+				log.Printf("Warning: responses entry %q does not match any method", name)
+			}
+		}
+
+		server := grpc.NewServer(grpc.UnknownServiceHandler(mock.handle))
+		reflectionOptions := reflection.ServerOptions{
+			Services:           &grpcServiceInfo{server: server, mock: mock},
+			DescriptorResolver: files,
+		}
+		reflectionv1.RegisterServerReflectionServer(server, reflection.NewServerV1(reflectionOptions))
+		reflectionv1alpha.RegisterServerReflectionServer(server, reflection.NewServer(reflectionOptions))
+
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", grpcPort))
+		if err != nil {
+			log.Fatalf("Failed to listen: %v", err)
+		}
+
+		fmt.Printf("Listening at localhost:%d (gRPC, reflection enabled)\n", grpcPort)
+		for _, service := range mock.serviceNames() {
+			fmt.Printf("  %s\n", service)
+		}
+		if err := server.Serve(listener); err != nil {
+			log.Fatalf("Server failed: %v", err)
+		}
+	},
+}
+
+func init() {
+	serverCmd.AddCommand(serverGRPCCmd)
+	serverGRPCCmd.Flags().IntVarP(&grpcPort, "port", "p", 50051, "Port to listen on")
+	serverGRPCCmd.Flags().StringArrayVar(&grpcProtoFiles, "proto", nil, "Path to a .proto file; may be repeated")
+	serverGRPCCmd.Flags().StringArrayVarP(&grpcImportPaths, "import-path", "I", nil, "Directory to search for imports; may be repeated (default: each proto's directory)")
+	serverGRPCCmd.Flags().StringVar(&grpcDescriptorSet, "descriptor-set", "", "FileDescriptorSet file produced by protoc --descriptor_set_out")
+	serverGRPCCmd.Flags().StringVar(&grpcResponsesFile, "responses", "", "JSON file with responses keyed by package.Service/Method")
+	serverGRPCCmd.Flags().DurationVar(&grpcDelay, "delay", 0, "Delay before answering every call (for example 250ms, 2s)")
+}
+
+type grpcMockResponse struct {
+	Response  json.RawMessage   `json:"response"`
+	Responses []json.RawMessage `json:"responses"`
+	Code      string            `json:"code"`
+	Message   string            `json:"message"`
+	Delay     string            `json:"delay"`
+
+	code  codes.Code
+	delay time.Duration
+}
+
+func loadGRPCResponses(path string) (map[string]grpcMockResponse, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]grpcMockResponse
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	responses := make(map[string]grpcMockResponse, len(raw))
+	for name, response := range raw {
+		if response.Code != "" {
+			if err := response.code.UnmarshalJSON([]byte(`"` + strings.ToUpper(response.Code) + `"`)); err != nil {
+				return nil, fmt.Errorf("%s: invalid status code %q", name, response.Code)
+			}
+		}
+		if response.Delay != "" {
+			response.delay, err = time.ParseDuration(response.Delay)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid delay %q", name, response.Delay)
+			}
+		}
+		if response.Response != nil {
+			response.Responses = append([]json.RawMessage{response.Response}, response.Responses...)
+		}
+		responses[strings.TrimPrefix(name, "/")] = response
+	}
+	return responses, nil
+}
+
+// loadGRPCDescriptors compiles .proto sources or reads a descriptor set and
+// returns a registry holding every file and its dependencies.
+func loadGRPCDescriptors(protoFiles, importPaths []string, descriptorSet string) (*protoregistry.Files, error) {
+	if descriptorSet != "" {
+		data, err := os.ReadFile(descriptorSet)
+		if err != nil {
+			return nil, err
+		}
+		var set descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(data, &set); err != nil {
+			return nil, fmt.Errorf("%s is not a FileDescriptorSet: %w", descriptorSet, err)
+		}
+		return protodesc.NewFiles(&set)
+	}
+
+	// Without explicit import paths, each file is resolved relative to its
+	// own directory, which is how most single-service protos are laid out.
+	names := make([]string, 0, len(protoFiles))
+	paths := importPaths
+	for _, file := range protoFiles {
+		if len(importPaths) > 0 {
+			name := file
+			for _, importPath := range importPaths {
+				if rel, err := filepath.Rel(importPath, file); err == nil && !strings.HasPrefix(rel, "..") {
+					name = rel
+					break
+				}
+			}
+			names = append(names, filepath.ToSlash(name))
+			continue
+		}
+		paths = append(paths, filepath.Dir(file))
+		names = append(names, filepath.Base(file))
+	}
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: paths}),
+	}
+	compiled, err := compiler.Compile(context.Background(), names...)
+	if err != nil {
+		return nil, err
+	}
+
+	files := new(protoregistry.Files)
+	var register func(fd protoreflect.FileDescriptor) error
+	register = func(fd protoreflect.FileDescriptor) error {
+		if _, err := files.FindFileByPath(fd.Path()); err == nil {
+			return nil
+		}
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			if err := register(imports.Get(i).FileDescriptor); err != nil {
+				return err
+			}
+		}
+		return files.RegisterFile(fd)
+	}
+	for _, fd := range compiled {
+		if err := register(fd); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+type grpcMock struct {
+	methods   map[string]protoreflect.MethodDescriptor
+	services  map[string][]protoreflect.MethodDescriptor
+	responses map[string]grpcMockResponse
+	delay     time.Duration
+}
+
+func newGRPCMock(files *protoregistry.Files, responses map[string]grpcMockResponse, delay time.Duration) *grpcMock {
+	mock := &grpcMock{
+		methods:   make(map[string]protoreflect.MethodDescriptor),
+		services:  make(map[string][]protoreflect.MethodDescriptor),
+		responses: responses,
+		delay:     delay,
+	}
+
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		services := fd.Services()
+		for i := 0; i < services.Len(); i++ {
+			service := services.Get(i)
+			methods := service.Methods()
+			for j := 0; j < methods.Len(); j++ {
+				method := methods.Get(j)
+				mock.methods[fmt.Sprintf("/%s/%s", service.FullName(), method.Name())] = method
+				mock.services[string(service.FullName())] = append(mock.services[string(service.FullName())], method)
+			}
+		}
+		return true
+	})
+	return mock
+}
+
+func (m *grpcMock) serviceNames() []string {
+	names := make([]string, 0, len(m.services))
+	for name := range m.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// handle serves every call that is not the reflection service.
+func (m *grpcMock) handle(_ any, stream grpc.ServerStream) error {
+	fullMethod, _ := grpc.MethodFromServerStream(stream)
+	method, ok := m.methods[fullMethod]
+	if !ok {
+		return status.Errorf(codes.Unimplemented, "unknown method %s", fullMethod)
+	}
+
+	ctx := stream.Context()
+	start := time.Now()
+	config := m.responses[strings.TrimPrefix(fullMethod, "/")]
+
+	logData := map[string]any{
+		"timestamp": time.Now().Format(time.RFC3339),
+		"method":    fullMethod,
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		logData["remote_addr"] = p.Addr.String()
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		headers := make(map[string]string, len(md))
+		for key, values := range md {
+			headers[key] = strings.Join(values, ", ")
+		}
+		logData["metadata"] = headers
+	}
+
+	var mu sync.Mutex
+	var requests []json.RawMessage
+	recv := func() (bool, error) {
+		msg := dynamicpb.NewMessage(method.Input())
+		if err := stream.RecvMsg(msg); err != nil {
+			if err == io.EOF {
+				return false, nil
+			}
+			return false, err
+		}
+		encoded, err := protojson.Marshal(msg)
+		if err != nil {
+			encoded = []byte(`null`)
+		}
+		mu.Lock()
+		requests = append(requests, encoded)
+		mu.Unlock()
+		return true, nil
+	}
+
+	sent := 0
+	send := func(index int) error {
+		msg := dynamicpb.NewMessage(method.Output())
+		if len(config.Responses) > 0 {
+			raw := config.Responses[index%len(config.Responses)]
+			if err := protojson.Unmarshal(raw, msg); err != nil {
+				return status.Errorf(codes.Internal, "devtool: configured response for %s does not match %s: %v", fullMethod, method.Output().FullName(), err)
+			}
+		}
+		if err := stream.SendMsg(msg); err != nil {
+			return err
+		}
+		sent++
+		return nil
+	}
+
+	err := m.serve(method, config, recv, send)
+
+	code := status.Code(err)
+	mu.Lock()
+	logData["requests"] = requests
+	mu.Unlock()
+	logData["code"] = code.String()
+	logData["responses"] = sent
+	logData["duration_ms"] = time.Since(start).Milliseconds()
+	if err != nil && code != config.code {
+		logData["error"] = err.Error()
+	}
+
+	payload, marshalErr := json.Marshal(logData)
+	if marshalErr != nil {
+		log.Printf("Failed to marshal call log: %v", marshalErr)
+	} else {
+		log.Println(string(payload))
+	}
+
+	return err
+}
+
+func (m *grpcMock) serve(method protoreflect.MethodDescriptor, config grpcMockResponse, recv func() (bool, error), send func(int) error) error {
+	wait := func() {
+		if delay := m.delay + config.delay; delay > 0 {
+			time.Sleep(delay)
+		}
+	}
+	failure := func() error {
+		if config.code == codes.OK {
+			return nil
+		}
+		return status.Error(config.code, config.Message)
+	}
+
+	if method.IsStreamingClient() && method.IsStreamingServer() {
+		for i := 0; ; i++ {
+			ok, err := recv()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return failure()
+			}
+			if err := failure(); err != nil {
+				return err
+			}
+			wait()
+			if err := send(i); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Unary and server-streaming calls carry exactly one request; client
+	// streams are drained before answering.
+	for {
+		ok, err := recv()
+		if err != nil {
+			return err
+		}
+		if !ok || !method.IsStreamingClient() {
+			break
+		}
+	}
+
+	wait()
+	if err := failure(); err != nil {
+		return err
+	}
+
+	count := 1
+	if method.IsStreamingServer() && len(config.Responses) > 0 {
+		count = len(config.Responses)
+	}
+	for i := 0; i < count; i++ {
+		if err := send(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// grpcServiceInfo reports the mocked services to the reflection service
+// alongside the ones registered on the server itself.
+type grpcServiceInfo struct {
+	server *grpc.Server
+	mock   *grpcMock
+}
+
+func (g *grpcServiceInfo) GetServiceInfo() map[string]grpc.ServiceInfo {
+	info := g.server.GetServiceInfo()
+	for name, methods := range g.mock.services {
+		service := grpc.ServiceInfo{}
+		for _, method := range methods {
+			service.Methods = append(service.Methods, grpc.MethodInfo{
+				Name:           string(method.Name()),
+				IsClientStream: method.IsStreamingClient(),
+				IsServerStream: method.IsStreamingServer(),
+			})
+		}
+		info[name] = service
+	}
+	return info
+}
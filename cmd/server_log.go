@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tidwall/pretty"
+)
+
+var requestLogFormats = []string{"json", "pretty", "curl", "har"}
+
+// requestLogEntry is everything requestLogger captures about one request.
+type requestLogEntry struct {
+	Time            time.Time
+	RemoteAddr      string
+	Method          string
+	URL             string
+	Proto           string
+	Host            string
+	TLS             bool
+	Headers         http.Header
+	Body            string
+	BodyTruncated   bool
+	Status          int
+	ResponseBytes   int
+	ResponseHeaders http.Header
+	Duration        time.Duration
+}
+
+func validRequestLogFormat(format string) bool {
+	for _, known := range requestLogFormats {
+		if format == known {
+			return true
+		}
+	}
+	return false
+}
+
+func writeRequestLog(entry *requestLogEntry, format string) {
+	switch format {
+	case "pretty":
+		fmt.Fprint(log.Writer(), formatPrettyRequestLog(entry, logColorEnabled()))
+	case "curl":
+		fmt.Fprintln(log.Writer(), formatCurlRequestLog(entry))
+	case "har":
+		payload, err := json.Marshal(harEntry(entry))
+		if err != nil {
+			log.Printf("Failed to marshal request log: %v", err)
+			return
+		}
+		fmt.Fprintln(log.Writer(), string(payload))
+	default:
+		payload, err := json.Marshal(jsonRequestLog(entry))
+		if err != nil {
+			log.Printf("Failed to marshal request log: %v", err)
+			return
+		}
+		log.Println(string(payload))
+	}
+}
+
+// logColorEnabled reports whether the log output is a terminal, so colour
+// codes are not written into redirected log files.
+func logColorEnabled() bool {
+	file, ok := log.Writer().(*os.File)
+	if !ok {
+		return false
+	}
+	stat, err := file.Stat()
+	return err == nil && (stat.Mode()&os.ModeCharDevice) != 0
+}
+
+func (e *requestLogEntry) fullURL() string {
+	scheme := "http"
+	if e.TLS {
+		scheme = "https"
+	}
+	return scheme + "://" + e.Host + e.URL
+}
+
+func jsonRequestLog(entry *requestLogEntry) map[string]any {
+	headers := make(map[string]string, len(entry.Headers))
+	for key, values := range entry.Headers {
+		headers[key] = strings.Join(values, ", ")
+	}
+
+	logData := map[string]any{
+		"timestamp":      entry.Time.Format(time.RFC3339),
+		"remote_addr":    entry.RemoteAddr,
+		"method":         entry.Method,
+		"url":            entry.URL,
+		"proto":          entry.Proto,
+		"host":           entry.Host,
+		"headers":        headers,
+		"status":         entry.Status,
+		"response_bytes": entry.ResponseBytes,
+		"duration_ms":    entry.Duration.Milliseconds(),
+		"body":           entry.Body,
+	}
+	if entry.BodyTruncated {
+		logData["body_truncated"] = true
+	}
+	return logData
+}
+
+func sortedHeaderKeys(headers http.Header) []string {
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatPrettyRequestLog(entry *requestLogEntry, color bool) string {
+	paint := func(code, text string) string {
+		if !color {
+			return text
+		}
+		return "\033[" + code + "m" + text + "\033[0m"
+	}
+
+	statusColor := "1;32"
+	switch {
+	case entry.Status >= 500:
+		statusColor = "1;31"
+	case entry.Status >= 400:
+		statusColor = "1;33"
+	case entry.Status >= 300:
+		statusColor = "1;36"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s %s %s %s\n",
+		paint("2", entry.Time.Format("15:04:05.000")),
+		paint("1;34", entry.Method),
+		paint("1", entry.URL),
+		paint(statusColor, fmt.Sprintf("%d %s", entry.Status, http.StatusText(entry.Status))),
+		paint("2", fmt.Sprintf("(%s, %d B)", entry.Duration.Round(time.Microsecond), entry.ResponseBytes)),
+	)
+	fmt.Fprintf(&b, "  %s %s  %s %s  %s %s\n",
+		paint("2", "remote:"), entry.RemoteAddr,
+		paint("2", "host:"), entry.Host,
+		paint("2", "proto:"), entry.Proto,
+	)
+
+	if len(entry.Headers) > 0 {
+		fmt.Fprintf(&b, "  %s\n", paint("1", "Headers"))
+		for _, key := range sortedHeaderKeys(entry.Headers) {
+			fmt.Fprintf(&b, "    %s %s\n", paint("36", key+":"), strings.Join(entry.Headers.Values(key), ", "))
+		}
+	}
+
+	if entry.Body != "" {
+		fmt.Fprintf(&b, "  %s\n", paint("1", "Body"))
+		body := formatLogBody(entry.Headers.Get("Content-Type"), entry.Body, color)
+		for _, line := range strings.Split(strings.TrimRight(body, "\n"), "\n") {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+		if entry.BodyTruncated {
+			fmt.Fprintf(&b, "    %s\n", paint("33", "… (truncated)"))
+		}
+	}
+
+	b.WriteString("\n")
+	return b.String()
+}
+
+// formatLogBody pretty-prints a captured body according to its content
+// type: JSON is indented (and coloured) like the json command, form posts
+// are listed as key/value pairs and binary data is summarised.
+func formatLogBody(contentType, body string, color bool) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") || (mediaType == "" && json.Valid([]byte(body))):
+		if json.Valid([]byte(body)) {
+			result := pretty.Pretty([]byte(body))
+			if color {
+				result = pretty.Color(result, nil)
+			}
+			return string(result)
+		}
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(body)
+		if err == nil {
+			var b strings.Builder
+			keys := make([]string, 0, len(values))
+			for key := range values {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				for _, value := range values[key] {
+					fmt.Fprintf(&b, "%s = %s\n", key, value)
+				}
+			}
+			return b.String()
+		}
+	}
+
+	if !utf8.ValidString(body) {
+		return fmt.Sprintf("<%d bytes of binary data>", len(body))
+	}
+	return body
+}
+
+func formatCurlRequestLog(entry *requestLogEntry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s %s %s -> %d (%dms)\n", entry.Time.Format(time.RFC3339), entry.RemoteAddr, entry.Method, entry.Status, entry.Duration.Milliseconds())
+	if entry.BodyTruncated {
+		b.WriteString("# warning: request body was truncated by --log-body-limit\n")
+	}
+
+	b.WriteString("curl")
+	if entry.TLS {
+		b.WriteString(" -k")
+	}
+	// curl infers GET, or POST when a body is given.
+	inferred := http.MethodGet
+	if entry.Body != "" {
+		inferred = http.MethodPost
+	}
+	switch {
+	case entry.Method == http.MethodHead:
+		// -X HEAD would leave curl waiting for a body that never comes.
+		b.WriteString(" -I")
+	case entry.Method != inferred:
+		fmt.Fprintf(&b, " -X %s", entry.Method)
+	}
+	b.WriteString(" " + shellQuote(entry.fullURL()))
+
+	for _, key := range sortedHeaderKeys(entry.Headers) {
+		// curl sets these itself from the URL and body.
+		if key == "Content-Length" || key == "Host" {
+			continue
+		}
+		for _, value := range entry.Headers.Values(key) {
+			b.WriteString(" \\\n  -H " + shellQuote(key+": "+value))
+		}
+	}
+
+	if entry.Body != "" {
+		b.WriteString(" \\\n  --data-binary " + shellQuote(entry.Body))
+	}
+	return b.String()
+}
+
+// shellQuote wraps s in single quotes for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func harHeaders(headers http.Header) []harNameValue {
+	list := []harNameValue{}
+	for _, key := range sortedHeaderKeys(headers) {
+		for _, value := range headers.Values(key) {
+			list = append(list, harNameValue{Name: key, Value: value})
+		}
+	}
+	return list
+}
+
+// harEntry converts a request into a HAR 1.2 entry. Response bodies are not
+// captured, so only their size and type are recorded.
+func harEntry(entry *requestLogEntry) map[string]any {
+	query := []harNameValue{}
+	if parsed, err := url.Parse(entry.URL); err == nil {
+		values := parsed.Query()
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			for _, value := range values[key] {
+				query = append(query, harNameValue{Name: key, Value: value})
+			}
+		}
+	}
+
+	request := map[string]any{
+		"method":      entry.Method,
+		"url":         entry.fullURL(),
+		"httpVersion": entry.Proto,
+		"headers":     harHeaders(entry.Headers),
+		"queryString": query,
+		"cookies":     []any{},
+		"headersSize": -1,
+		"bodySize":    len(entry.Body),
+	}
+	if entry.Body != "" {
+		postData := map[string]any{
+			"mimeType": entry.Headers.Get("Content-Type"),
+			"text":     entry.Body,
+		}
+		if entry.BodyTruncated {
+			postData["comment"] = "truncated by --log-body-limit"
+		}
+		request["postData"] = postData
+	}
+
+	var mimeType string
+	if entry.ResponseHeaders != nil {
+		mimeType = entry.ResponseHeaders.Get("Content-Type")
+	}
+	elapsed := float64(entry.Duration.Microseconds()) / 1000
+
+	return map[string]any{
+		"startedDateTime": entry.Time.Format(time.RFC3339Nano),
+		"time":            elapsed,
+		"request":         request,
+		"response": map[string]any{
+			"status":      entry.Status,
+			"statusText":  http.StatusText(entry.Status),
+			"httpVersion": entry.Proto,
+			"headers":     harHeaders(entry.ResponseHeaders),
+			"cookies":     []any{},
+			"content": map[string]any{
+				"size":     entry.ResponseBytes,
+				"mimeType": mimeType,
+			},
+			"redirectURL": "",
+			"headersSize": -1,
+			"bodySize":    entry.ResponseBytes,
+		},
+		"cache": map[string]any{},
+		"timings": map[string]any{
+			"send":    0,
+			"wait":    elapsed,
+			"receive": 0,
+		},
+		"_remoteAddr": entry.RemoteAddr,
+	}
+}
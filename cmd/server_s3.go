@@ -0,0 +1,1082 @@
+package cmd
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var s3Port int
+var s3Dir string
+var s3AccessKey string
+var s3SecretKey string
+var s3RequireAuth bool
+
+// serverS3Cmd represents the server s3 command
+var serverS3Cmd = &cobra.Command{
+	Use:   "s3",
+	Short: "Start a local S3-compatible object store backed by a directory",
+	Long: `Start a local S3-compatible object store that keeps buckets as
+directories and objects as regular files under --dir.
+
+Supported operations:
+  - ListBuckets, CreateBucket, HeadBucket, DeleteBucket, GetBucketLocation
+  - ListObjects and ListObjectsV2 (prefix, delimiter, pagination)
+  - PutObject, CopyObject, GetObject (with ranges), HeadObject,
+    DeleteObject and DeleteObjects
+  - Multipart uploads: create, upload part, list parts, complete, abort
+
+Requests signed with AWS Signature Version 4, either in the Authorization
+header or as a presigned URL, are verified against --access-key and
+--secret-key, including presigned URL expiry. Unsigned requests are
+accepted unless --require-auth is set.
+
+Clients must use path-style addressing (http://localhost:9000/bucket/key).
+Object metadata and in-progress multipart uploads are kept in a hidden
+.devtool-s3 directory inside --dir.`,
+	Example: `  devtool server s3 --dir ./buckets
+  devtool server s3 --dir ./buckets --port 9100 --require-auth
+  AWS_ACCESS_KEY_ID=devtool AWS_SECRET_ACCESS_KEY=devtool-secret \
+    aws --endpoint-url http://localhost:9000 s3 cp file.txt s3://test/file.txt`,
+	Run: func(cmd *cobra.Command, args []string) {
+		root, err := filepath.Abs(s3Dir)
+		if err != nil {
+			log.Fatalf("Invalid directory: %v", err)
+		}
+		if err := os.MkdirAll(filepath.Join(root, s3MetaDir), 0755); err != nil {
+			log.Fatalf("Failed to create storage directory: %v", err)
+		}
+
+		server := &s3Server{
+			root:        root,
+			accessKey:   s3AccessKey,
+			secretKey:   s3SecretKey,
+			requireAuth: s3RequireAuth,
+		}
+
+		addr := fmt.Sprintf(":%d", s3Port)
+		fmt.Printf("Listening at http://localhost%s — S3 buckets in %s\n", addr, root)
+		fmt.Printf("Credentials: access key %q, secret key %q\n", s3AccessKey, s3SecretKey)
+		if err := http.ListenAndServe(addr, requestLogger(server, 0, "json")); err != nil {
+			log.Fatalf("Server failed: %v", err)
+		}
+	},
+}
+
+func init() {
+	serverCmd.AddCommand(serverS3Cmd)
+	serverS3Cmd.Flags().IntVarP(&s3Port, "port", "p", 9000, "Port to listen on")
+	serverS3Cmd.Flags().StringVarP(&s3Dir, "dir", "d", "./buckets", "Directory that holds the buckets")
+	serverS3Cmd.Flags().StringVar(&s3AccessKey, "access-key", "devtool", "Access key ID accepted for signed requests")
+	serverS3Cmd.Flags().StringVar(&s3SecretKey, "secret-key", "devtool-secret", "Secret access key used to verify signatures")
+	serverS3Cmd.Flags().BoolVar(&s3RequireAuth, "require-auth", false, "Reject requests that are not signed")
+}
+
+const s3MetaDir = ".devtool-s3"
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+const s3TimeFormat = "2006-01-02T15:04:05.000Z"
+
+var s3BucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+type s3Error struct {
+	status  int
+	Code    string
+	Message string
+}
+
+func (e *s3Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func newS3Error(status int, code, message string) *s3Error {
+	return &s3Error{status: status, Code: code, Message: message}
+}
+
+var (
+	errS3NoSuchBucket = newS3Error(http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+	errS3NoSuchKey    = newS3Error(http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+	errS3NoSuchUpload = newS3Error(http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist")
+)
+
+// s3ObjectMeta is stored next to each object under .devtool-s3/meta.
+type s3ObjectMeta struct {
+	ContentType        string            `json:"content_type,omitempty"`
+	ContentEncoding    string            `json:"content_encoding,omitempty"`
+	ContentDisposition string            `json:"content_disposition,omitempty"`
+	CacheControl       string            `json:"cache_control,omitempty"`
+	ETag               string            `json:"etag"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+}
+
+type s3Server struct {
+	root        string
+	accessKey   string
+	secretKey   string
+	requireAuth bool
+}
+
+func (s *s3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := s.authenticate(r); err != nil {
+		writeS3Error(w, r, err)
+		return
+	}
+
+	if err := s.route(w, r); err != nil {
+		writeS3Error(w, r, err)
+	}
+}
+
+func (s *s3Server) route(w http.ResponseWriter, r *http.Request) error {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+
+	if bucket == "" {
+		if r.Method != http.MethodGet {
+			return newS3Error(http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource")
+		}
+		return s.listBuckets(w)
+	}
+
+	if key == "" {
+		switch {
+		case r.Method == http.MethodPut:
+			return s.createBucket(w, bucket)
+		case r.Method == http.MethodHead:
+			_, err := s.bucketDir(bucket)
+			return err
+		case r.Method == http.MethodDelete:
+			return s.deleteBucket(w, bucket)
+		case r.Method == http.MethodGet && query.Has("location"):
+			if _, err := s.bucketDir(bucket); err != nil {
+				return err
+			}
+			return writeS3XML(w, http.StatusOK, struct {
+				XMLName xml.Name `xml:"LocationConstraint"`
+				Xmlns   string   `xml:"xmlns,attr"`
+			}{Xmlns: s3Namespace})
+		case r.Method == http.MethodGet && query.Has("uploads"):
+			return s.listMultipartUploads(w, bucket)
+		case r.Method == http.MethodGet:
+			return s.listObjects(w, bucket, query)
+		case r.Method == http.MethodPost && query.Has("delete"):
+			return s.deleteObjects(w, r, bucket)
+		}
+		return newS3Error(http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource")
+	}
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		return s.createMultipartUpload(w, r, bucket, key)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		return s.uploadPart(w, r, bucket, key, query.Get("uploadId"), query.Get("partNumber"))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		return s.completeMultipartUpload(w, r, bucket, key, query.Get("uploadId"))
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		return s.abortMultipartUpload(w, bucket, key, query.Get("uploadId"))
+	case r.Method == http.MethodGet && query.Has("uploadId"):
+		return s.listParts(w, bucket, key, query.Get("uploadId"))
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		return s.copyObject(w, r, bucket, key)
+	case r.Method == http.MethodPut:
+		return s.putObject(w, r, bucket, key)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return s.getObject(w, r, bucket, key)
+	case r.Method == http.MethodDelete:
+		return s.deleteObject(w, bucket, key)
+	}
+	return newS3Error(http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource")
+}
+
+func (s *s3Server) bucketDir(bucket string) (string, error) {
+	if !s3BucketNamePattern.MatchString(bucket) {
+		return "", errS3NoSuchBucket
+	}
+	dir := filepath.Join(s.root, bucket)
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return "", errS3NoSuchBucket
+	}
+	return dir, nil
+}
+
+// objectPaths maps a key to its data file and metadata file. Keys that
+// would escape the bucket or cannot be represented as files are rejected.
+func (s *s3Server) objectPaths(bucket, key string) (string, string, error) {
+	if _, err := s.bucketDir(bucket); err != nil {
+		return "", "", err
+	}
+	if strings.HasSuffix(key, "/") || key != path.Clean("/" + key)[1:] {
+		return "", "", newS3Error(http.StatusBadRequest, "InvalidArgument", "devtool only supports keys that map to plain file paths")
+	}
+	dataPath := filepath.Join(s.root, bucket, filepath.FromSlash(key))
+	metaPath := filepath.Join(s.root, s3MetaDir, "meta", bucket, filepath.FromSlash(key)+".json")
+	return dataPath, metaPath, nil
+}
+
+func (s *s3Server) listBuckets(w http.ResponseWriter) error {
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		return err
+	}
+
+	type bucketEntry struct {
+		Name         string `xml:"Name"`
+		CreationDate string `xml:"CreationDate"`
+	}
+	result := struct {
+		XMLName xml.Name      `xml:"ListAllMyBucketsResult"`
+		Xmlns   string        `xml:"xmlns,attr"`
+		OwnerID string        `xml:"Owner>ID"`
+		Owner   string        `xml:"Owner>DisplayName"`
+		Buckets []bucketEntry `xml:"Buckets>Bucket"`
+	}{Xmlns: s3Namespace, OwnerID: "devtool", Owner: "devtool"}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !s3BucketNamePattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		result.Buckets = append(result.Buckets, bucketEntry{
+			Name:         entry.Name(),
+			CreationDate: info.ModTime().UTC().Format(s3TimeFormat),
+		})
+	}
+
+	return writeS3XML(w, http.StatusOK, result)
+}
+
+func (s *s3Server) createBucket(w http.ResponseWriter, bucket string) error {
+	if !s3BucketNamePattern.MatchString(bucket) {
+		return newS3Error(http.StatusBadRequest, "InvalidBucketName", "The specified bucket is not valid")
+	}
+	dir := filepath.Join(s.root, bucket)
+	if _, err := os.Stat(dir); err == nil {
+		return newS3Error(http.StatusConflict, "BucketAlreadyOwnedByYou", "The bucket already exists")
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return err
+	}
+	w.Header().Set("Location", "/"+bucket)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *s3Server) deleteBucket(w http.ResponseWriter, bucket string) error {
+	dir, err := s.bucketDir(bucket)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return newS3Error(http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty")
+	}
+	if err := os.Remove(dir); err != nil {
+		return err
+	}
+	_ = os.RemoveAll(filepath.Join(s.root, s3MetaDir, "meta", bucket))
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type s3ObjectEntry struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type s3CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+func (s *s3Server) listObjects(w http.ResponseWriter, bucket string, query map[string][]string) error {
+	dir, err := s.bucketDir(bucket)
+	if err != nil {
+		return err
+	}
+
+	get := func(name string) string {
+		if values := query[name]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	v2 := get("list-type") == "2"
+	prefix := get("prefix")
+	delimiter := get("delimiter")
+	maxKeys := 1000
+	if raw := get("max-keys"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			return newS3Error(http.StatusBadRequest, "InvalidArgument", "max-keys must be a non-negative integer")
+		}
+		maxKeys = min(value, 1000)
+	}
+
+	after := get("marker")
+	if v2 {
+		after = get("start-after")
+		if token := get("continuation-token"); token != "" {
+			decoded, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil {
+				return newS3Error(http.StatusBadRequest, "InvalidArgument", "The continuation token provided is incorrect")
+			}
+			after = string(decoded)
+		}
+	}
+
+	var keys []string
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(keys)
+
+	var contents []s3ObjectEntry
+	var prefixes []s3CommonPrefix
+	truncated := false
+	lastEntry := ""
+	afterIsPrefix := delimiter != "" && strings.HasSuffix(after, delimiter)
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) || key <= after {
+			continue
+		}
+		if afterIsPrefix && strings.HasPrefix(key, after) {
+			continue
+		}
+
+		entry := key
+		isPrefix := false
+		if delimiter != "" {
+			if idx := strings.Index(key[len(prefix):], delimiter); idx >= 0 {
+				entry = key[:len(prefix)+idx+len(delimiter)]
+				isPrefix = true
+				if entry == lastEntry {
+					continue
+				}
+			}
+		}
+
+		if len(contents)+len(prefixes) >= maxKeys {
+			truncated = true
+			break
+		}
+		lastEntry = entry
+
+		if isPrefix {
+			prefixes = append(prefixes, s3CommonPrefix{Prefix: entry})
+			continue
+		}
+
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(key)))
+		if err != nil {
+			continue
+		}
+		meta := s.readObjectMeta(bucket, key)
+		contents = append(contents, s3ObjectEntry{
+			Key:          key,
+			LastModified: info.ModTime().UTC().Format(s3TimeFormat),
+			ETag:         meta.ETag,
+			Size:         info.Size(),
+			StorageClass: "STANDARD",
+		})
+	}
+
+	if v2 {
+		result := struct {
+			XMLName               xml.Name         `xml:"ListBucketResult"`
+			Xmlns                 string           `xml:"xmlns,attr"`
+			Name                  string           `xml:"Name"`
+			Prefix                string           `xml:"Prefix"`
+			Delimiter             string           `xml:"Delimiter,omitempty"`
+			StartAfter            string           `xml:"StartAfter,omitempty"`
+			ContinuationToken     string           `xml:"ContinuationToken,omitempty"`
+			NextContinuationToken string           `xml:"NextContinuationToken,omitempty"`
+			KeyCount              int              `xml:"KeyCount"`
+			MaxKeys               int              `xml:"MaxKeys"`
+			IsTruncated           bool             `xml:"IsTruncated"`
+			Contents              []s3ObjectEntry  `xml:"Contents"`
+			CommonPrefixes        []s3CommonPrefix `xml:"CommonPrefixes"`
+		}{
+			Xmlns:             s3Namespace,
+			Name:              bucket,
+			Prefix:            prefix,
+			Delimiter:         delimiter,
+			StartAfter:        get("start-after"),
+			ContinuationToken: get("continuation-token"),
+			KeyCount:          len(contents) + len(prefixes),
+			MaxKeys:           maxKeys,
+			IsTruncated:       truncated,
+			Contents:          contents,
+			CommonPrefixes:    prefixes,
+		}
+		if truncated {
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(lastEntry))
+		}
+		return writeS3XML(w, http.StatusOK, result)
+	}
+
+	result := struct {
+		XMLName        xml.Name         `xml:"ListBucketResult"`
+		Xmlns          string           `xml:"xmlns,attr"`
+		Name           string           `xml:"Name"`
+		Prefix         string           `xml:"Prefix"`
+		Marker         string           `xml:"Marker"`
+		NextMarker     string           `xml:"NextMarker,omitempty"`
+		Delimiter      string           `xml:"Delimiter,omitempty"`
+		MaxKeys        int              `xml:"MaxKeys"`
+		IsTruncated    bool             `xml:"IsTruncated"`
+		Contents       []s3ObjectEntry  `xml:"Contents"`
+		CommonPrefixes []s3CommonPrefix `xml:"CommonPrefixes"`
+	}{
+		Xmlns:          s3Namespace,
+		Name:           bucket,
+		Prefix:         prefix,
+		Marker:         get("marker"),
+		Delimiter:      delimiter,
+		MaxKeys:        maxKeys,
+		IsTruncated:    truncated,
+		Contents:       contents,
+		CommonPrefixes: prefixes,
+	}
+	if truncated {
+		result.NextMarker = lastEntry
+	}
+	return writeS3XML(w, http.StatusOK, result)
+}
+
+func (s *s3Server) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	dataPath, metaPath, err := s.objectPaths(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	etag, err := writeS3File(dataPath, s3RequestBody(r))
+	if err != nil {
+		return err
+	}
+
+	meta := s3MetaFromHeaders(r.Header)
+	meta.ETag = etag
+	if err := writeS3Meta(metaPath, meta); err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *s3Server) copyObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	source := r.Header.Get("X-Amz-Copy-Source")
+	if unescaped, err := url.PathUnescape(source); err == nil {
+		source = unescaped
+	}
+	source, _, _ = strings.Cut(source, "?")
+	srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+
+	srcPath, _, err := s.objectPaths(srcBucket, srcKey)
+	if err != nil {
+		return err
+	}
+	dataPath, metaPath, err := s.objectPaths(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return errS3NoSuchKey
+	}
+	defer src.Close()
+
+	etag, err := writeS3File(dataPath, src)
+	if err != nil {
+		return err
+	}
+
+	meta := s.readObjectMeta(srcBucket, srcKey)
+	if strings.EqualFold(r.Header.Get("X-Amz-Metadata-Directive"), "REPLACE") {
+		meta = s3MetaFromHeaders(r.Header)
+	}
+	meta.ETag = etag
+	if err := writeS3Meta(metaPath, meta); err != nil {
+		return err
+	}
+
+	return writeS3XML(w, http.StatusOK, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		Xmlns        string   `xml:"xmlns,attr"`
+		LastModified string   `xml:"LastModified"`
+		ETag         string   `xml:"ETag"`
+	}{Xmlns: s3Namespace, LastModified: time.Now().UTC().Format(s3TimeFormat), ETag: etag})
+}
+
+func (s *s3Server) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	dataPath, _, err := s.objectPaths(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(dataPath)
+	if err != nil {
+		return errS3NoSuchKey
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		return errS3NoSuchKey
+	}
+
+	meta := s.readObjectMeta(bucket, key)
+	contentType := meta.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("ETag", meta.ETag)
+	header.Set("Accept-Ranges", "bytes")
+	for name, value := range map[string]string{
+		"Content-Encoding":    meta.ContentEncoding,
+		"Content-Disposition": meta.ContentDisposition,
+		"Cache-Control":       meta.CacheControl,
+	} {
+		if value != "" {
+			header.Set(name, value)
+		}
+	}
+	for name, value := range meta.Metadata {
+		header.Set("X-Amz-Meta-"+name, value)
+	}
+
+	http.ServeContent(w, r, "", info.ModTime(), file)
+	return nil
+}
+
+func (s *s3Server) deleteObject(w http.ResponseWriter, bucket, key string) error {
+	dataPath, metaPath, err := s.objectPaths(bucket, key)
+	if err != nil {
+		return err
+	}
+	s.removeObjectFiles(bucket, dataPath, metaPath)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *s3Server) deleteObjects(w http.ResponseWriter, r *http.Request, bucket string) error {
+	if _, err := s.bucketDir(bucket); err != nil {
+		return err
+	}
+
+	var request struct {
+		Quiet   bool `xml:"Quiet"`
+		Objects []struct {
+			Key string `xml:"Key"`
+		} `xml:"Object"`
+	}
+	if err := readS3XML(r, &request); err != nil {
+		return err
+	}
+
+	type deleted struct {
+		Key string `xml:"Key"`
+	}
+	type deleteError struct {
+		Key     string `xml:"Key"`
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	result := struct {
+		XMLName xml.Name      `xml:"DeleteResult"`
+		Xmlns   string        `xml:"xmlns,attr"`
+		Deleted []deleted     `xml:"Deleted"`
+		Errors  []deleteError `xml:"Error"`
+	}{Xmlns: s3Namespace}
+
+	for _, object := range request.Objects {
+		dataPath, metaPath, err := s.objectPaths(bucket, object.Key)
+		if err != nil {
+			var s3Err *s3Error
+			if errors.As(err, &s3Err) {
+				result.Errors = append(result.Errors, deleteError{Key: object.Key, Code: s3Err.Code, Message: s3Err.Message})
+			}
+			continue
+		}
+		s.removeObjectFiles(bucket, dataPath, metaPath)
+		if !request.Quiet {
+			result.Deleted = append(result.Deleted, deleted{Key: object.Key})
+		}
+	}
+
+	return writeS3XML(w, http.StatusOK, result)
+}
+
+// removeObjectFiles deletes an object and its metadata, then prunes
+// directories that only existed to hold it.
+func (s *s3Server) removeObjectFiles(bucket, dataPath, metaPath string) {
+	_ = os.Remove(dataPath)
+	_ = os.Remove(metaPath)
+	pruneEmptyDirs(filepath.Dir(dataPath), filepath.Join(s.root, bucket))
+	pruneEmptyDirs(filepath.Dir(metaPath), filepath.Join(s.root, s3MetaDir, "meta", bucket))
+}
+
+func pruneEmptyDirs(dir, stop string) {
+	for dir != stop && strings.HasPrefix(dir, stop) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+type s3Upload struct {
+	Bucket   string       `json:"bucket"`
+	Key      string       `json:"key"`
+	Started  time.Time    `json:"started"`
+	Meta     s3ObjectMeta `json:"meta"`
+	uploadID string
+}
+
+func (s *s3Server) uploadDir(uploadID string) string {
+	return filepath.Join(s.root, s3MetaDir, "uploads", uploadID)
+}
+
+func (s *s3Server) loadUpload(bucket, key, uploadID string) (*s3Upload, error) {
+	if _, err := hex.DecodeString(uploadID); err != nil || uploadID == "" {
+		return nil, errS3NoSuchUpload
+	}
+	data, err := os.ReadFile(filepath.Join(s.uploadDir(uploadID), "upload.json"))
+	if err != nil {
+		return nil, errS3NoSuchUpload
+	}
+	var upload s3Upload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, err
+	}
+	if upload.Bucket != bucket || upload.Key != key {
+		return nil, errS3NoSuchUpload
+	}
+	upload.uploadID = uploadID
+	return &upload, nil
+}
+
+func (s *s3Server) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	if _, _, err := s.objectPaths(bucket, key); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	uploadID := hex.EncodeToString(buf)
+
+	upload := s3Upload{Bucket: bucket, Key: key, Started: time.Now().UTC(), Meta: s3MetaFromHeaders(r.Header)}
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.uploadDir(uploadID), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(s.uploadDir(uploadID), "upload.json"), data, 0644); err != nil {
+		return err
+	}
+
+	return writeS3XML(w, http.StatusOK, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		UploadID string   `xml:"UploadId"`
+	}{Xmlns: s3Namespace, Bucket: bucket, Key: key, UploadID: uploadID})
+}
+
+func (s *s3Server) uploadPart(w http.ResponseWriter, r *http.Request, bucket, key, uploadID, partNumber string) error {
+	upload, err := s.loadUpload(bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	number, err := strconv.Atoi(partNumber)
+	if err != nil || number < 1 || number > 10000 {
+		return newS3Error(http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and 10000")
+	}
+
+	etag, err := writeS3File(filepath.Join(s.uploadDir(upload.uploadID), fmt.Sprintf("part-%05d", number)), s3RequestBody(r))
+	if err != nil {
+		return err
+	}
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+type s3Part struct {
+	PartNumber   int    `xml:"PartNumber"`
+	LastModified string `xml:"LastModified,omitempty"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size,omitempty"`
+}
+
+func (s *s3Server) uploadedParts(uploadID string) ([]s3Part, error) {
+	entries, err := os.ReadDir(s.uploadDir(uploadID))
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []s3Part
+	for _, entry := range entries {
+		var number int
+		if _, err := fmt.Sscanf(entry.Name(), "part-%05d", &number); err != nil {
+			continue
+		}
+		partPath := filepath.Join(s.uploadDir(uploadID), entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		etag, err := fileETag(partPath)
+		if err != nil {
+			continue
+		}
+		parts = append(parts, s3Part{
+			PartNumber:   number,
+			LastModified: info.ModTime().UTC().Format(s3TimeFormat),
+			ETag:         etag,
+			Size:         info.Size(),
+		})
+	}
+	return parts, nil
+}
+
+func (s *s3Server) listParts(w http.ResponseWriter, bucket, key, uploadID string) error {
+	upload, err := s.loadUpload(bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	parts, err := s.uploadedParts(upload.uploadID)
+	if err != nil {
+		return err
+	}
+
+	return writeS3XML(w, http.StatusOK, struct {
+		XMLName     xml.Name `xml:"ListPartsResult"`
+		Xmlns       string   `xml:"xmlns,attr"`
+		Bucket      string   `xml:"Bucket"`
+		Key         string   `xml:"Key"`
+		UploadID    string   `xml:"UploadId"`
+		IsTruncated bool     `xml:"IsTruncated"`
+		Parts       []s3Part `xml:"Part"`
+	}{Xmlns: s3Namespace, Bucket: bucket, Key: key, UploadID: uploadID, Parts: parts})
+}
+
+func (s *s3Server) listMultipartUploads(w http.ResponseWriter, bucket string) error {
+	if _, err := s.bucketDir(bucket); err != nil {
+		return err
+	}
+
+	type uploadEntry struct {
+		Key       string `xml:"Key"`
+		UploadID  string `xml:"UploadId"`
+		Initiated string `xml:"Initiated"`
+	}
+	result := struct {
+		XMLName     xml.Name      `xml:"ListMultipartUploadsResult"`
+		Xmlns       string        `xml:"xmlns,attr"`
+		Bucket      string        `xml:"Bucket"`
+		IsTruncated bool          `xml:"IsTruncated"`
+		Uploads     []uploadEntry `xml:"Upload"`
+	}{Xmlns: s3Namespace, Bucket: bucket}
+
+	entries, _ := os.ReadDir(filepath.Join(s.root, s3MetaDir, "uploads"))
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(s.uploadDir(entry.Name()), "upload.json"))
+		if err != nil {
+			continue
+		}
+		var upload s3Upload
+		if json.Unmarshal(data, &upload) != nil || upload.Bucket != bucket {
+			continue
+		}
+		result.Uploads = append(result.Uploads, uploadEntry{
+			Key:       upload.Key,
+			UploadID:  entry.Name(),
+			Initiated: upload.Started.Format(s3TimeFormat),
+		})
+	}
+
+	return writeS3XML(w, http.StatusOK, result)
+}
+
+func (s *s3Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key, uploadID string) error {
+	upload, err := s.loadUpload(bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	dataPath, metaPath, err := s.objectPaths(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	var request struct {
+		Parts []s3Part `xml:"Part"`
+	}
+	if err := readS3XML(r, &request); err != nil {
+		return err
+	}
+	if len(request.Parts) == 0 {
+		return errS3MalformedXML
+	}
+
+	uploaded, err := s.uploadedParts(uploadID)
+	if err != nil {
+		return err
+	}
+	available := make(map[int]string, len(uploaded))
+	for _, part := range uploaded {
+		available[part.PartNumber] = part.ETag
+	}
+
+	readers := make([]io.Reader, 0, len(request.Parts))
+	digests := md5.New()
+	previous := 0
+	for _, part := range request.Parts {
+		if part.PartNumber <= previous {
+			return newS3Error(http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order")
+		}
+		previous = part.PartNumber
+
+		etag, ok := available[part.PartNumber]
+		if !ok || (part.ETag != "" && strings.Trim(part.ETag, `"`) != strings.Trim(etag, `"`)) {
+			return newS3Error(http.StatusBadRequest, "InvalidPart", fmt.Sprintf("Part %d was not uploaded or its ETag does not match", part.PartNumber))
+		}
+		raw, _ := hex.DecodeString(strings.Trim(etag, `"`))
+		digests.Write(raw)
+
+		file, err := os.Open(filepath.Join(s.uploadDir(uploadID), fmt.Sprintf("part-%05d", part.PartNumber)))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		readers = append(readers, file)
+	}
+
+	if _, err := writeS3File(dataPath, io.MultiReader(readers...)); err != nil {
+		return err
+	}
+
+	// Multipart ETags are the MD5 of the concatenated part MD5s plus the
+	// part count, matching what S3 returns.
+	etag := fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(digests.Sum(nil)), len(request.Parts))
+	meta := upload.Meta
+	meta.ETag = etag
+	if err := writeS3Meta(metaPath, meta); err != nil {
+		return err
+	}
+	_ = os.RemoveAll(s.uploadDir(uploadID))
+
+	return writeS3XML(w, http.StatusOK, struct {
+		XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Location string   `xml:"Location"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		ETag     string   `xml:"ETag"`
+	}{Xmlns: s3Namespace, Location: "/" + bucket + "/" + key, Bucket: bucket, Key: key, ETag: etag})
+}
+
+func (s *s3Server) abortMultipartUpload(w http.ResponseWriter, bucket, key, uploadID string) error {
+	upload, err := s.loadUpload(bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(s.uploadDir(upload.uploadID)); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *s3Server) readObjectMeta(bucket, key string) s3ObjectMeta {
+	var meta s3ObjectMeta
+	metaPath := filepath.Join(s.root, s3MetaDir, "meta", bucket, filepath.FromSlash(key)+".json")
+	if data, err := os.ReadFile(metaPath); err == nil {
+		_ = json.Unmarshal(data, &meta)
+	}
+
+	// Files copied into the bucket directory by hand have no metadata yet.
+	if meta.ETag == "" {
+		meta.ETag, _ = fileETag(filepath.Join(s.root, bucket, filepath.FromSlash(key)))
+	}
+	return meta
+}
+
+func s3MetaFromHeaders(header http.Header) s3ObjectMeta {
+	meta := s3ObjectMeta{
+		ContentType:        header.Get("Content-Type"),
+		ContentDisposition: header.Get("Content-Disposition"),
+		CacheControl:       header.Get("Cache-Control"),
+	}
+
+	// aws-chunked is a transfer detail of the upload, not part of the object.
+	var encodings []string
+	for _, encoding := range strings.Split(header.Get("Content-Encoding"), ",") {
+		encoding = strings.TrimSpace(encoding)
+		if encoding != "" && encoding != "aws-chunked" {
+			encodings = append(encodings, encoding)
+		}
+	}
+	meta.ContentEncoding = strings.Join(encodings, ",")
+
+	for name, values := range header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-meta-") && len(values) > 0 {
+			if meta.Metadata == nil {
+				meta.Metadata = make(map[string]string)
+			}
+			meta.Metadata[strings.TrimPrefix(lower, "x-amz-meta-")] = values[0]
+		}
+	}
+	return meta
+}
+
+var errS3MalformedXML = newS3Error(http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed")
+
+// readS3XML decodes an XML request body. The body is read to the end so
+// that its signed payload hash is checked before anything is acted on.
+func readS3XML(r *http.Request, v any) error {
+	body, err := io.ReadAll(s3RequestBody(r))
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(body, v); err != nil {
+		return errS3MalformedXML
+	}
+	return nil
+}
+
+// writeS3File writes r to path through a temporary file so readers never
+// see a partially written object, and returns the quoted MD5 ETag.
+func writeS3File(path string, r io.Reader) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", newS3Error(http.StatusConflict, "InvalidArgument", "The key conflicts with an existing object")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := md5.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), r); err != nil {
+		_ = tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", newS3Error(http.StatusConflict, "InvalidArgument", "The key conflicts with an existing object")
+	}
+	return `"` + hex.EncodeToString(hash.Sum(nil)) + `"`, nil
+}
+
+func writeS3Meta(path string, meta s3ObjectMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func fileETag(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return `"` + hex.EncodeToString(hash.Sum(nil)) + `"`, nil
+}
+
+func writeS3XML(w http.ResponseWriter, status int, value any) error {
+	payload, err := xml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, xml.Header)
+	_, _ = w.Write(payload)
+	return nil
+}
+
+func writeS3Error(w http.ResponseWriter, r *http.Request, err error) {
+	var s3Err *s3Error
+	if !errors.As(err, &s3Err) {
+		s3Err = newS3Error(http.StatusInternalServerError, "InternalError", err.Error())
+	}
+
+	if r.Method == http.MethodHead {
+		w.WriteHeader(s3Err.status)
+		return
+	}
+
+	_ = writeS3XML(w, s3Err.status, struct {
+		XMLName  xml.Name `xml:"Error"`
+		Code     string   `xml:"Code"`
+		Message  string   `xml:"Message"`
+		Resource string   `xml:"Resource"`
+	}{Code: s3Err.Code, Message: s3Err.Message, Resource: r.URL.Path})
+}
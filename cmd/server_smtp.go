@@ -0,0 +1,571 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var smtpPort int
+var smtpHTTPPort int
+var smtpMaildir string
+var smtpStartTLS bool
+var smtpMaxSize int64
+
+// serverSMTPCmd represents the server smtp command
+var serverSMTPCmd = &cobra.Command{
+	Use:   "smtp",
+	Short: "Start a local SMTP server that captures mail and shows it in a web UI",
+	Long: `Start a local SMTP server that accepts every message it receives and
+keeps it for inspection instead of delivering it.
+
+Mail is accepted over plain SMTP and, unless --starttls=false is given,
+STARTTLS using a self-signed certificate. Any AUTH PLAIN or AUTH LOGIN
+credentials are accepted so applications configured with a username and
+password can send without changes.
+
+Messages are kept in memory by default. Use --maildir to store them in a
+Maildir directory instead, which survives restarts and can be opened by
+regular mail clients.
+
+Captured mail is available through a small web UI and a JSON API on
+--http-port:
+  GET    /                              Inbox
+  GET    /messages/{id}                 Message view
+  GET    /api/messages                  List messages
+  DELETE /api/messages                  Delete all messages
+  GET    /api/messages/{id}             Parsed message with MIME parts
+  DELETE /api/messages/{id}             Delete a message
+  GET    /api/messages/{id}/raw         Raw RFC 5322 source
+  GET    /api/messages/{id}/parts/{n}   Decoded MIME part or attachment`,
+	Example: `  devtool server smtp
+  devtool server smtp --port 2525 --http-port 9025
+  devtool server smtp --maildir ./mail
+  devtool server smtp --starttls=false --max-size 25000000`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if smtpMaxSize <= 0 {
+			log.Fatalf("Invalid max size %d. Must be greater than zero.", smtpMaxSize)
+		}
+
+		var store mailStore
+		if smtpMaildir != "" {
+			maildir, err := newMaildirStore(smtpMaildir)
+			if err != nil {
+				log.Fatalf("Failed to open maildir: %v", err)
+			}
+			store = maildir
+		} else {
+			store = &memoryMailStore{}
+		}
+
+		var tlsConfig *tls.Config
+		if smtpStartTLS {
+			certPEM, keyPEM, err := generateSelfSignedCert()
+			if err != nil {
+				log.Fatalf("Failed to generate self-signed certificate: %v", err)
+			}
+
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil {
+				log.Fatalf("Failed to load generic key pair: %v", err)
+			}
+			tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		}
+
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", smtpPort))
+		if err != nil {
+			log.Fatalf("Failed to listen for SMTP: %v", err)
+		}
+
+		go func() {
+			addr := fmt.Sprintf(":%d", smtpHTTPPort)
+			if err := serveMailUI(addr, store); err != nil {
+				log.Fatalf("Web UI failed: %v", err)
+			}
+		}()
+
+		mode := "plain"
+		if tlsConfig != nil {
+			mode = "plain + STARTTLS"
+		}
+		fmt.Printf("SMTP listening at localhost:%d (%s)\n", smtpPort, mode)
+		fmt.Printf("Web UI at http://localhost:%d\n", smtpHTTPPort)
+		if smtpMaildir != "" {
+			fmt.Printf("Storing messages in maildir %s\n", smtpMaildir)
+		}
+
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log.Printf("Failed to accept SMTP connection: %v", err)
+				continue
+			}
+
+			session := &smtpSession{
+				conn:      conn,
+				tlsConfig: tlsConfig,
+				store:     store,
+				maxSize:   smtpMaxSize,
+			}
+			go session.serve()
+		}
+	},
+}
+
+func init() {
+	serverCmd.AddCommand(serverSMTPCmd)
+	serverSMTPCmd.Flags().IntVarP(&smtpPort, "port", "p", 1025, "SMTP port to listen on")
+	serverSMTPCmd.Flags().IntVar(&smtpHTTPPort, "http-port", 8025, "Port for the web UI and JSON API")
+	serverSMTPCmd.Flags().StringVar(&smtpMaildir, "maildir", "", "Store messages in this Maildir directory instead of memory")
+	serverSMTPCmd.Flags().BoolVar(&smtpStartTLS, "starttls", true, "Offer STARTTLS with a self-signed certificate")
+	serverSMTPCmd.Flags().Int64Var(&smtpMaxSize, "max-size", 10*1024*1024, "Maximum accepted message size in bytes")
+}
+
+type smtpSession struct {
+	conn      net.Conn
+	text      *textproto.Conn
+	tlsConfig *tls.Config
+	store     mailStore
+	maxSize   int64
+
+	helo    string
+	from    string
+	rcpts   []string
+	hasMail bool
+	tls     bool
+}
+
+func (s *smtpSession) serve() {
+	defer s.conn.Close()
+	s.text = textproto.NewConn(s.conn)
+
+	s.reply(220, "devtool ESMTP capture server ready")
+
+	for {
+		_ = s.conn.SetReadDeadline(time.Now().Add(5 * time.Minute))
+		line, err := s.text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			s.helo = arg
+			s.reset()
+			s.reply(250, "devtool")
+		case "EHLO":
+			s.helo = arg
+			s.reset()
+			extensions := []string{"devtool", "PIPELINING", "8BITMIME", fmt.Sprintf("SIZE %d", s.maxSize), "AUTH PLAIN LOGIN"}
+			if s.tlsConfig != nil && !s.tls {
+				extensions = append(extensions, "STARTTLS")
+			}
+			s.reply(250, extensions...)
+		case "STARTTLS":
+			if s.tlsConfig == nil || s.tls {
+				s.reply(502, "STARTTLS not available")
+				continue
+			}
+			s.reply(220, "Ready to start TLS")
+			tlsConn := tls.Server(s.conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				log.Printf("SMTP TLS handshake with %s failed: %v", s.conn.RemoteAddr(), err)
+				return
+			}
+			s.conn = tlsConn
+			s.text = textproto.NewConn(tlsConn)
+			s.tls = true
+			s.helo = ""
+			s.reset()
+		case "AUTH":
+			s.auth(arg)
+		case "MAIL":
+			addr, ok := parseSMTPPath(arg, "FROM:")
+			if !ok {
+				s.reply(501, "Syntax: MAIL FROM:<address>")
+				continue
+			}
+			s.reset()
+			s.from = addr
+			s.hasMail = true
+			s.reply(250, "OK")
+		case "RCPT":
+			if !s.hasMail {
+				s.reply(503, "Need MAIL before RCPT")
+				continue
+			}
+			addr, ok := parseSMTPPath(arg, "TO:")
+			if !ok || addr == "" {
+				s.reply(501, "Syntax: RCPT TO:<address>")
+				continue
+			}
+			s.rcpts = append(s.rcpts, addr)
+			s.reply(250, "OK")
+		case "DATA":
+			if len(s.rcpts) == 0 {
+				s.reply(503, "Need RCPT before DATA")
+				continue
+			}
+			s.data()
+		case "RSET":
+			s.reset()
+			s.reply(250, "OK")
+		case "NOOP":
+			s.reply(250, "OK")
+		case "VRFY":
+			s.reply(252, "Cannot verify user, but will accept message")
+		case "QUIT":
+			s.reply(221, "Bye")
+			return
+		default:
+			s.reply(502, "Command not implemented")
+		}
+	}
+}
+
+func (s *smtpSession) reset() {
+	s.from = ""
+	s.rcpts = nil
+	s.hasMail = false
+}
+
+func (s *smtpSession) reply(code int, lines ...string) {
+	for i, line := range lines {
+		sep := " "
+		if i < len(lines)-1 {
+			sep = "-"
+		}
+		_ = s.text.PrintfLine("%d%s%s", code, sep, line)
+	}
+}
+
+// auth accepts any AUTH PLAIN or AUTH LOGIN credentials.
+func (s *smtpSession) auth(arg string) {
+	mechanism, initial, _ := strings.Cut(arg, " ")
+
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		if initial == "" {
+			s.reply(334, "")
+			if _, err := s.text.ReadLine(); err != nil {
+				return
+			}
+		}
+	case "LOGIN":
+		if initial == "" {
+			s.reply(334, base64.StdEncoding.EncodeToString([]byte("Username:")))
+			if _, err := s.text.ReadLine(); err != nil {
+				return
+			}
+		}
+		s.reply(334, base64.StdEncoding.EncodeToString([]byte("Password:")))
+		if _, err := s.text.ReadLine(); err != nil {
+			return
+		}
+	default:
+		s.reply(504, "Unrecognized authentication type")
+		return
+	}
+
+	s.reply(235, "Authentication successful")
+}
+
+func (s *smtpSession) data() {
+	s.reply(354, "End data with <CR><LF>.<CR><LF>")
+
+	_ = s.conn.SetReadDeadline(time.Now().Add(10 * time.Minute))
+	message := s.text.DotReader()
+	body, err := io.ReadAll(io.LimitReader(message, s.maxSize+1))
+	if err != nil {
+		log.Printf("Failed to read message from %s: %v", s.conn.RemoteAddr(), err)
+		return
+	}
+	if int64(len(body)) > s.maxSize {
+		// Drain the rest of the message so the connection stays usable.
+		_, _ = io.Copy(io.Discard, message)
+		s.reset()
+		s.reply(552, "Message exceeds maximum size")
+		return
+	}
+
+	// Record the envelope the way a delivery agent would, so it survives
+	// in both the in-memory and Maildir stores.
+	var envelope strings.Builder
+	fmt.Fprintf(&envelope, "Return-Path: <%s>\n", s.from)
+	for _, rcpt := range s.rcpts {
+		fmt.Fprintf(&envelope, "Delivered-To: %s\n", rcpt)
+	}
+	fmt.Fprintf(&envelope, "Received: from %s (%s) by devtool; %s\n", s.helo, s.conn.RemoteAddr(), time.Now().Format(time.RFC1123Z))
+	raw := append([]byte(envelope.String()), body...)
+
+	stored, err := s.store.Save(raw)
+	if err != nil {
+		log.Printf("Failed to store message: %v", err)
+		s.reset()
+		s.reply(451, "Failed to store message")
+		return
+	}
+
+	logData := map[string]any{
+		"timestamp":   time.Now().Format(time.RFC3339),
+		"remote_addr": s.conn.RemoteAddr().String(),
+		"id":          stored.ID,
+		"from":        s.from,
+		"to":          s.rcpts,
+		"size":        len(raw),
+		"tls":         s.tls,
+	}
+	if parsed, err := parseMail(stored); err == nil {
+		logData["subject"] = parsed.Subject
+	}
+	payload, marshalErr := json.Marshal(logData)
+	if marshalErr != nil {
+		log.Printf("Failed to marshal mail log: %v", marshalErr)
+	} else {
+		log.Println(string(payload))
+	}
+
+	s.reset()
+	s.reply(250, "OK: queued as "+stored.ID)
+}
+
+// parseSMTPPath extracts the address from a "FROM:<addr> PARAMS" or
+// "TO:<addr> PARAMS" argument. The null reverse-path "<>" is valid.
+func parseSMTPPath(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	path := strings.TrimSpace(arg[len(prefix):])
+	if strings.HasPrefix(path, "<") {
+		end := strings.Index(path, ">")
+		if end < 0 {
+			return "", false
+		}
+		return path[1:end], true
+	}
+
+	addr, _, _ := strings.Cut(path, " ")
+	return addr, addr != ""
+}
+
+var errMailNotFound = errors.New("message not found")
+
+type storedMail struct {
+	ID       string
+	Received time.Time
+	Raw      []byte
+}
+
+type mailStore interface {
+	Save(raw []byte) (storedMail, error)
+	List() ([]storedMail, error)
+	Get(id string) (storedMail, error)
+	Delete(id string) error
+	Clear() error
+}
+
+func newMailID() string {
+	buf := make([]byte, 6)
+	_, _ = rand.Read(buf)
+	return fmt.Sprintf("%d.%s", time.Now().UnixNano(), hex.EncodeToString(buf))
+}
+
+type memoryMailStore struct {
+	mu       sync.RWMutex
+	messages []storedMail
+}
+
+func (m *memoryMailStore) Save(raw []byte) (storedMail, error) {
+	msg := storedMail{ID: newMailID(), Received: time.Now(), Raw: raw}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return msg, nil
+}
+
+func (m *memoryMailStore) List() ([]storedMail, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]storedMail, len(m.messages))
+	for i, msg := range m.messages {
+		list[len(m.messages)-1-i] = msg
+	}
+	return list, nil
+}
+
+func (m *memoryMailStore) Get(id string) (storedMail, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, msg := range m.messages {
+		if msg.ID == id {
+			return msg, nil
+		}
+	}
+	return storedMail{}, errMailNotFound
+}
+
+func (m *memoryMailStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, msg := range m.messages {
+		if msg.ID == id {
+			m.messages = append(m.messages[:i], m.messages[i+1:]...)
+			return nil
+		}
+	}
+	return errMailNotFound
+}
+
+func (m *memoryMailStore) Clear() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+	return nil
+}
+
+// maildirStore keeps messages in a Maildir: new messages are written to
+// tmp/ and renamed into new/, and both new/ and cur/ are read back.
+type maildirStore struct {
+	root string
+}
+
+func newMaildirStore(root string) (*maildirStore, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(root, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &maildirStore{root: root}, nil
+}
+
+func (m *maildirStore) Save(raw []byte) (storedMail, error) {
+	id := newMailID()
+	tmpPath := filepath.Join(m.root, "tmp", id)
+	if err := os.WriteFile(tmpPath, raw, 0644); err != nil {
+		return storedMail{}, err
+	}
+	if err := os.Rename(tmpPath, filepath.Join(m.root, "new", id)); err != nil {
+		_ = os.Remove(tmpPath)
+		return storedMail{}, err
+	}
+	return storedMail{ID: id, Received: time.Now(), Raw: raw}, nil
+}
+
+func (m *maildirStore) List() ([]storedMail, error) {
+	var list []storedMail
+	for _, sub := range []string{"new", "cur"} {
+		entries, err := os.ReadDir(filepath.Join(m.root, sub))
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			msg, err := m.read(filepath.Join(m.root, sub, entry.Name()))
+			if err != nil {
+				continue
+			}
+			list = append(list, msg)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Received.After(list[j].Received)
+	})
+	return list, nil
+}
+
+func (m *maildirStore) Get(id string) (storedMail, error) {
+	path, err := m.find(id)
+	if err != nil {
+		return storedMail{}, err
+	}
+	return m.read(path)
+}
+
+func (m *maildirStore) Delete(id string) error {
+	path, err := m.find(id)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (m *maildirStore) Clear() error {
+	for _, sub := range []string{"new", "cur"} {
+		entries, err := os.ReadDir(filepath.Join(m.root, sub))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			if err := os.Remove(filepath.Join(m.root, sub, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// find locates a message by its unique name. Files in cur/ carry a
+// ":2,FLAGS" info suffix that is not part of the ID.
+func (m *maildirStore) find(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return "", errMailNotFound
+	}
+	// List the directories rather than globbing, so that the id is never
+	// interpreted as a pattern.
+	for _, sub := range []string{"new", "cur"} {
+		entries, err := os.ReadDir(filepath.Join(m.root, sub))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if name == id || strings.HasPrefix(name, id+":") {
+				return filepath.Join(m.root, sub, name), nil
+			}
+		}
+	}
+	return "", errMailNotFound
+}
+
+func (m *maildirStore) read(path string) (storedMail, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return storedMail{}, err
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return storedMail{}, err
+	}
+
+	id, _, _ := strings.Cut(filepath.Base(path), ":")
+	return storedMail{ID: id, Received: info.ModTime(), Raw: raw}, nil
+}
@@ -0,0 +1,438 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type mailSummary struct {
+	ID          string    `json:"id"`
+	Received    time.Time `json:"received"`
+	From        string    `json:"from"`
+	To          []string  `json:"to"`
+	Subject     string    `json:"subject"`
+	Size        int       `json:"size"`
+	Attachments int       `json:"attachments"`
+}
+
+type mailPart struct {
+	Index       int    `json:"index"`
+	ContentType string `json:"content_type"`
+	Charset     string `json:"charset,omitempty"`
+	Filename    string `json:"filename,omitempty"`
+	ContentID   string `json:"content_id,omitempty"`
+	Attachment  bool   `json:"attachment"`
+	Size        int    `json:"size"`
+	Content     string `json:"content,omitempty"`
+
+	data []byte
+}
+
+type parsedMail struct {
+	mailSummary
+	EnvelopeFrom string              `json:"envelope_from"`
+	EnvelopeTo   []string            `json:"envelope_to"`
+	Cc           []string            `json:"cc,omitempty"`
+	Date         string              `json:"date,omitempty"`
+	Headers      map[string][]string `json:"headers"`
+	Text         string              `json:"text,omitempty"`
+	HTML         string              `json:"html,omitempty"`
+	Parts        []mailPart          `json:"parts"`
+
+	headerLines []string
+}
+
+type mailHeader interface {
+	Get(key string) string
+}
+
+// parseMail decodes a stored message into its headers and a flat list of
+// MIME leaf parts. Text parts that are not attachments carry their decoded
+// content; everything else is available through the parts endpoint.
+func parseMail(stored storedMail) (*parsedMail, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(stored.Raw))
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := new(mime.WordDecoder)
+	decode := func(value string) string {
+		decoded, err := decoder.DecodeHeader(value)
+		if err != nil {
+			return value
+		}
+		return decoded
+	}
+
+	parsed := &parsedMail{
+		mailSummary: mailSummary{
+			ID:       stored.ID,
+			Received: stored.Received,
+			From:     decode(msg.Header.Get("From")),
+			To:       mailAddressList(msg.Header, "To"),
+			Subject:  decode(msg.Header.Get("Subject")),
+			Size:     len(stored.Raw),
+		},
+		EnvelopeFrom: strings.Trim(msg.Header.Get("Return-Path"), "<>"),
+		EnvelopeTo:   msg.Header["Delivered-To"],
+		Cc:           mailAddressList(msg.Header, "Cc"),
+		Date:         msg.Header.Get("Date"),
+		Headers:      make(map[string][]string, len(msg.Header)),
+		headerLines:  readMailHeaderLines(stored.Raw),
+	}
+	for key, values := range msg.Header {
+		decoded := make([]string, len(values))
+		for i, value := range values {
+			decoded[i] = decode(value)
+		}
+		parsed.Headers[key] = decoded
+	}
+
+	if err := collectMailParts(msg.Header, msg.Body, &parsed.Parts); err != nil {
+		return nil, err
+	}
+
+	for _, part := range parsed.Parts {
+		if part.Attachment {
+			parsed.Attachments++
+			continue
+		}
+		switch {
+		case part.ContentType == "text/plain" && parsed.Text == "":
+			parsed.Text = part.Content
+		case part.ContentType == "text/html" && parsed.HTML == "":
+			parsed.HTML = part.Content
+		}
+	}
+
+	return parsed, nil
+}
+
+func collectMailParts(header mailHeader, body io.Reader, parts *[]mailPart) error {
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "application/octet-stream", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := collectMailParts(part.Header, part, parts); err != nil {
+				return err
+			}
+		}
+	}
+
+	var decoded io.Reader = body
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		decoded = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		decoded = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(decoded)
+	if err != nil {
+		return err
+	}
+
+	part := mailPart{
+		Index:       len(*parts),
+		ContentType: mediaType,
+		Charset:     params["charset"],
+		ContentID:   strings.Trim(header.Get("Content-ID"), "<>"),
+		Size:        len(data),
+		data:        data,
+	}
+
+	if disposition, dispParams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		part.Attachment = disposition == "attachment"
+		part.Filename = dispParams["filename"]
+	}
+	if part.Filename == "" {
+		part.Filename = params["name"]
+	}
+	if part.Filename != "" && !strings.HasPrefix(mediaType, "text/") {
+		part.Attachment = true
+	}
+	if !part.Attachment && strings.HasPrefix(mediaType, "text/") {
+		part.Content = string(data)
+	}
+
+	*parts = append(*parts, part)
+	return nil
+}
+
+func mailAddressList(header mail.Header, key string) []string {
+	addresses, err := header.AddressList(key)
+	if err != nil {
+		if value := header.Get(key); value != "" {
+			return []string{value}
+		}
+		return nil
+	}
+
+	list := make([]string, 0, len(addresses))
+	for _, addr := range addresses {
+		list = append(list, addr.String())
+	}
+	return list
+}
+
+// readMailHeaderLines returns the top-level header lines in the order they
+// were received, which the message map cannot preserve.
+func readMailHeaderLines(raw []byte) []string {
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(raw)))
+	var lines []string
+	for {
+		line, err := reader.ReadContinuedLine()
+		if err != nil || line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+func serveMailUI(addr string, store mailStore) error {
+	mux := http.NewServeMux()
+
+	loadMail := func(w http.ResponseWriter, r *http.Request) (*parsedMail, bool) {
+		stored, err := store.Get(r.PathValue("id"))
+		if err != nil {
+			writeMailError(w, err)
+			return nil, false
+		}
+		parsed, err := parseMail(stored)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to parse message: %v", err), http.StatusUnprocessableEntity)
+			return nil, false
+		}
+		return parsed, true
+	}
+
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		summaries, err := listMailSummaries(store)
+		if err != nil {
+			writeMailError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := mailInboxTemplate.Execute(w, summaries); err != nil {
+			log.Printf("Failed to render inbox: %v", err)
+		}
+	})
+
+	mux.HandleFunc("GET /messages/{id}", func(w http.ResponseWriter, r *http.Request) {
+		parsed, ok := loadMail(w, r)
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := mailMessageTemplate.Execute(w, parsed); err != nil {
+			log.Printf("Failed to render message: %v", err)
+		}
+	})
+
+	mux.HandleFunc("GET /api/messages", func(w http.ResponseWriter, r *http.Request) {
+		summaries, err := listMailSummaries(store)
+		if err != nil {
+			writeMailError(w, err)
+			return
+		}
+		writeMailJSON(w, summaries)
+	})
+
+	mux.HandleFunc("DELETE /api/messages", func(w http.ResponseWriter, r *http.Request) {
+		if err := store.Clear(); err != nil {
+			writeMailError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("GET /api/messages/{id}", func(w http.ResponseWriter, r *http.Request) {
+		parsed, ok := loadMail(w, r)
+		if !ok {
+			return
+		}
+		writeMailJSON(w, parsed)
+	})
+
+	mux.HandleFunc("DELETE /api/messages/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if err := store.Delete(r.PathValue("id")); err != nil {
+			writeMailError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("GET /api/messages/{id}/raw", func(w http.ResponseWriter, r *http.Request) {
+		stored, err := store.Get(r.PathValue("id"))
+		if err != nil {
+			writeMailError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		_, _ = w.Write(stored.Raw)
+	})
+
+	mux.HandleFunc("GET /api/messages/{id}/parts/{index}", func(w http.ResponseWriter, r *http.Request) {
+		parsed, ok := loadMail(w, r)
+		if !ok {
+			return
+		}
+		index, err := strconv.Atoi(r.PathValue("index"))
+		if err != nil || index < 0 || index >= len(parsed.Parts) {
+			http.Error(w, "part not found", http.StatusNotFound)
+			return
+		}
+
+		part := parsed.Parts[index]
+		contentType := part.ContentType
+		if part.Charset != "" {
+			contentType = mime.FormatMediaType(contentType, map[string]string{"charset": part.Charset})
+		}
+		w.Header().Set("Content-Type", contentType)
+		// Captured mail is untrusted: keep it from running script on the
+		// UI's origin when a part is opened directly.
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if part.Filename != "" {
+			disposition := "inline"
+			if part.Attachment {
+				disposition = "attachment"
+			}
+			w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": part.Filename}))
+		}
+		_, _ = w.Write(part.data)
+	})
+
+	return http.ListenAndServe(addr, mux)
+}
+
+func listMailSummaries(store mailStore) ([]mailSummary, error) {
+	messages, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]mailSummary, 0, len(messages))
+	for _, stored := range messages {
+		parsed, err := parseMail(stored)
+		if err != nil {
+			summaries = append(summaries, mailSummary{ID: stored.ID, Received: stored.Received, Size: len(stored.Raw)})
+			continue
+		}
+		summaries = append(summaries, parsed.mailSummary)
+	}
+	return summaries, nil
+}
+
+func writeMailJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+func writeMailError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errMailNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+const mailPageStyle = `<style>
+body { font-family: -apple-system, "Segoe UI", sans-serif; margin: 2rem; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .4rem .6rem; border-bottom: 1px solid #ddd; }
+tr:hover td { background: #f5f7fa; }
+pre { background: #f5f7fa; padding: 1rem; overflow-x: auto; white-space: pre-wrap; }
+iframe { width: 100%; height: 480px; border: 1px solid #ddd; }
+.muted { color: #777; }
+</style>`
+
+var mailInboxTemplate = template.Must(template.New("inbox").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>devtool mail</title>` + mailPageStyle + `</head>
+<body>
+<h1>Inbox <span class="muted">({{len .}})</span></h1>
+{{if .}}
+<table>
+<tr><th>Received</th><th>From</th><th>To</th><th>Subject</th><th>Size</th><th>Attachments</th></tr>
+{{range .}}
+<tr>
+<td>{{.Received.Format "2006-01-02 15:04:05"}}</td>
+<td>{{.From}}</td>
+<td>{{range $i, $to := .To}}{{if $i}}, {{end}}{{$to}}{{end}}</td>
+<td><a href="/messages/{{.ID}}">{{if .Subject}}{{.Subject}}{{else}}(no subject){{end}}</a></td>
+<td>{{.Size}}</td>
+<td>{{if .Attachments}}{{.Attachments}}{{end}}</td>
+</tr>
+{{end}}
+</table>
+{{else}}
+<p class="muted">No messages yet.</p>
+{{end}}
+</body></html>`))
+
+var mailMessageTemplate = template.Must(template.New("message").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Subject}}</title>` + mailPageStyle + `</head>
+<body>
+<p><a href="/">&larr; Inbox</a> &middot; <a href="/api/messages/{{.ID}}">JSON</a> &middot; <a href="/api/messages/{{.ID}}/raw">Raw</a></p>
+<h1>{{if .Subject}}{{.Subject}}{{else}}(no subject){{end}}</h1>
+<table>
+<tr><th>From</th><td>{{.From}}</td></tr>
+<tr><th>To</th><td>{{range $i, $to := .To}}{{if $i}}, {{end}}{{$to}}{{end}}</td></tr>
+{{if .Cc}}<tr><th>Cc</th><td>{{range $i, $cc := .Cc}}{{if $i}}, {{end}}{{$cc}}{{end}}</td></tr>{{end}}
+<tr><th>Date</th><td>{{.Date}}</td></tr>
+<tr><th>Envelope</th><td>{{.EnvelopeFrom}} &rarr; {{range $i, $to := .EnvelopeTo}}{{if $i}}, {{end}}{{$to}}{{end}}</td></tr>
+</table>
+{{if .HTML}}<h2>HTML</h2><iframe sandbox src="/api/messages/{{.ID}}/parts/{{range .Parts}}{{if and (eq .ContentType "text/html") (not .Attachment)}}{{.Index}}{{break}}{{end}}{{end}}"></iframe>{{end}}
+{{if .Text}}<h2>Text</h2><pre>{{.Text}}</pre>{{end}}
+<h2>Parts</h2>
+<table>
+<tr><th>#</th><th>Content type</th><th>Filename</th><th>Size</th><th></th></tr>
+{{range .Parts}}
+<tr><td>{{.Index}}</td><td>{{.ContentType}}</td><td>{{.Filename}}</td><td>{{.Size}}</td>
+<td><a href="/api/messages/{{$.ID}}/parts/{{.Index}}">{{if .Attachment}}download{{else}}view{{end}}</a></td></tr>
+{{end}}
+</table>
+<h2>Headers</h2>
+<pre>{{range .HeaderLines}}{{.}}
+{{end}}</pre>
+</body></html>`))
+
+// HeaderLines exposes the ordered header lines to the message template.
+func (p *parsedMail) HeaderLines() []string {
+	return p.headerLines
+}
@@ -0,0 +1,344 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	psnet "github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/spf13/cobra"
+)
+
+var topInterval time.Duration
+var topSort string
+var topDev bool
+var topListening bool
+var topUser string
+var topFilter string
+var topOnce bool
+var topCount int
+var topGrace time.Duration
+
+var topCmd = &cobra.Command{
+	Use:   "top",
+	Short: "Monitor processes with their CPU, memory and listening ports",
+	Long: `Shows a refreshing view of processes with CPU usage, memory (RSS), threads,
+open files and the ports each one listens on.
+
+--dev limits the view to dev tools (the same list as 'devtool kill --stale',
+configurable in kill.yaml) and --listening to processes with listening ports.
+
+Keys:
+  Up/Down     select a process
+  k           kill the selected process (SIGTERM, SIGKILL after --grace)
+  K           kill the selected process with SIGKILL
+  c m t o p   sort by CPU, memory, threads, open files or ports
+  i n         sort by PID or name
+  r           reverse the sort order
+  d l         toggle the dev tool and listening filters
+  /           filter by text (name, command, user, PID or port)
+  q           quit
+
+When stdout is not a terminal, or with --once, one snapshot is printed.`,
+	Example: `  devtool top
+  devtool top --dev --listening
+  devtool top --sort mem --user $USER
+  devtool top --once --count 10`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !validTopSort(topSort) {
+			fmt.Printf("Invalid sort column %q. Must be one of: %s\n", topSort, strings.Join(topSortColumns, ", "))
+			os.Exit(1)
+		}
+		if topInterval < 100*time.Millisecond {
+			fmt.Println("Error: --interval must be at least 100ms")
+			os.Exit(1)
+		}
+		config, err := loadKillConfig()
+		if err != nil {
+			fmt.Printf("Error reading kill config: %v\n", err)
+			os.Exit(1)
+		}
+
+		sampler := newTopSampler(devProcessNames(config))
+		view := topViewState{
+			filter: topRowFilter{Dev: topDev, Listening: topListening, User: topUser, Text: topFilter},
+			sortBy: topSort,
+		}
+
+		if topOnce || !stdoutIsTerminal() || !stdinIsTerminal() {
+			// CPU usage needs two samples.
+			sampler.sample(view.filter)
+			time.Sleep(500 * time.Millisecond)
+			rows, err := sampler.sample(view.filter)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			sortTopRows(rows, view.sortBy, view.reverse)
+			if topCount > 0 && len(rows) > topCount {
+				rows = rows[:topCount]
+			}
+			writeTopTable(os.Stdout, rows, 0)
+			return
+		}
+
+		if err := runTopView(sampler, view, config); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(topCmd)
+	topCmd.Flags().DurationVarP(&topInterval, "interval", "i", 2*time.Second, "Refresh interval")
+	topCmd.Flags().StringVarP(&topSort, "sort", "s", "cpu", "Sort column: cpu, mem, threads, files, ports, pid or name")
+	topCmd.Flags().BoolVarP(&topDev, "dev", "d", false, "Only show dev tools (node, python, java, go run, ...)")
+	topCmd.Flags().BoolVarP(&topListening, "listening", "l", false, "Only show processes listening on a port")
+	topCmd.Flags().StringVarP(&topUser, "user", "u", "", "Only show processes of this user")
+	topCmd.Flags().StringVarP(&topFilter, "filter", "f", "", "Only show processes whose name, command, user, PID or port contains this text")
+	topCmd.Flags().BoolVar(&topOnce, "once", false, "Print one snapshot and exit")
+	topCmd.Flags().IntVarP(&topCount, "count", "n", 0, "With --once, show at most this many processes")
+	topCmd.Flags().DurationVarP(&topGrace, "grace", "g", 5*time.Second, "How long a process killed from the view gets to exit before SIGKILL")
+}
+
+// topRow is one process in the view.
+type topRow struct {
+	PID     int32
+	Name    string
+	User    string
+	Cmdline string
+	CPU     float64
+	RSS     uint64
+	Threads int32
+	Files   int32
+	Ports   []int
+}
+
+// topRowFilter selects the processes to show.
+type topRowFilter struct {
+	Dev       bool
+	Listening bool
+	User      string
+	Text      string
+}
+
+// topProcess caches what does not change during a process's life, and its
+// previous CPU time for computing usage.
+type topProcess struct {
+	proc    *process.Process
+	name    string
+	user    string
+	cmdline string
+	dev     bool
+	cpu     float64
+	sampled time.Time
+}
+
+type topSampler struct {
+	devNames  []string
+	processes map[int32]*topProcess
+}
+
+func newTopSampler(devNames []string) *topSampler {
+	return &topSampler{devNames: devNames, processes: make(map[int32]*topProcess)}
+}
+
+// sample reads all processes and returns the ones matching filter. CPU
+// times are tracked for every process so that usage is known as soon as a
+// process starts matching; the other figures are only read for matches.
+func (s *topSampler) sample(filter topRowFilter) ([]topRow, error) {
+	pids, err := process.Pids()
+	if err != nil {
+		return nil, fmt.Errorf("listing processes: %v", err)
+	}
+	ports := make(map[int32][]int)
+	if connections, err := psnet.Connections("inet"); err == nil {
+		for _, conn := range connections {
+			if !isListener(conn) {
+				continue
+			}
+			port := int(conn.Laddr.Port)
+			if known := ports[conn.Pid]; len(known) == 0 || !containsPort(known, port) {
+				ports[conn.Pid] = append(known, port)
+			}
+		}
+	}
+
+	now := time.Now()
+	self := int32(os.Getpid())
+	seen := make(map[int32]bool, len(pids))
+	var rows []topRow
+	for _, pid := range pids {
+		if pid == self {
+			continue
+		}
+		cached := s.processes[pid]
+		if cached == nil {
+			proc, err := process.NewProcess(pid)
+			if err != nil {
+				continue
+			}
+			cached = &topProcess{proc: proc}
+			cached.name, _ = proc.Name()
+			cached.user, _ = proc.Username()
+			cached.cmdline, _ = proc.Cmdline()
+			cached.dev = isDevProcess(proc, s.devNames)
+			s.processes[pid] = cached
+		}
+		seen[pid] = true
+
+		row := topRow{PID: pid, Name: cached.name, User: cached.user, Cmdline: cached.cmdline, Ports: ports[pid]}
+		sort.Ints(row.Ports)
+		if times, err := cached.proc.Times(); err == nil {
+			total := times.User + times.System
+			if !cached.sampled.IsZero() {
+				row.CPU = (total - cached.cpu) / now.Sub(cached.sampled).Seconds() * 100
+			}
+			cached.cpu, cached.sampled = total, now
+		}
+
+		if !filter.matches(row, cached.dev) {
+			continue
+		}
+		if memory, err := cached.proc.MemoryInfo(); err == nil {
+			row.RSS = memory.RSS
+		}
+		row.Threads, _ = cached.proc.NumThreads()
+		row.Files, _ = cached.proc.NumFDs()
+		rows = append(rows, row)
+	}
+
+	for pid := range s.processes {
+		if !seen[pid] {
+			delete(s.processes, pid)
+		}
+	}
+	return rows, nil
+}
+
+func containsPort(ports []int, port int) bool {
+	for _, known := range ports {
+		if known == port {
+			return true
+		}
+	}
+	return false
+}
+
+func (f topRowFilter) matches(row topRow, dev bool) bool {
+	if f.Dev && !dev {
+		return false
+	}
+	if f.Listening && len(row.Ports) == 0 {
+		return false
+	}
+	if f.User != "" && row.User != f.User {
+		return false
+	}
+	if f.Text == "" {
+		return true
+	}
+	text := strings.ToLower(f.Text)
+	haystack := strings.ToLower(strings.Join([]string{strconv.Itoa(int(row.PID)), row.Name, row.User, row.Cmdline, formatPorts(row.Ports)}, " "))
+	return strings.Contains(haystack, text)
+}
+
+// topSortColumns are the values of --sort.
+var topSortColumns = []string{"cpu", "mem", "threads", "files", "ports", "pid", "name"}
+
+func validTopSort(column string) bool {
+	for _, known := range topSortColumns {
+		if column == known {
+			return true
+		}
+	}
+	return false
+}
+
+// sortTopRows sorts numeric columns largest first and PID, name and ports
+// ascending; reverse flips the order. Processes without ports sort last.
+func sortTopRows(rows []topRow, column string, reverse bool) {
+	less := func(a, b topRow) bool {
+		switch column {
+		case "mem":
+			return a.RSS > b.RSS
+		case "threads":
+			return a.Threads > b.Threads
+		case "files":
+			return a.Files > b.Files
+		case "ports":
+			if len(a.Ports) == 0 || len(b.Ports) == 0 {
+				return len(a.Ports) > len(b.Ports)
+			}
+			return a.Ports[0] < b.Ports[0]
+		case "pid":
+			return a.PID < b.PID
+		case "name":
+			return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+		}
+		return a.CPU > b.CPU
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if reverse {
+			return less(rows[j], rows[i])
+		}
+		return less(rows[i], rows[j])
+	})
+}
+
+func formatPorts(ports []int) string {
+	var list []string
+	for _, port := range ports {
+		list = append(list, strconv.Itoa(port))
+	}
+	return strings.Join(list, ",")
+}
+
+const topHeader = "    PID USER       CPU%       MEM  THR  FILES PORTS           NAME             COMMAND"
+
+// formatTopRow lays a row out in fixed columns so that the view does not
+// shift between refreshes.
+func formatTopRow(row topRow) string {
+	ports := formatPorts(row.Ports)
+	if ports == "" {
+		ports = "-"
+	}
+	if len(ports) > 15 {
+		ports = ports[:14] + "+"
+	}
+	line := fmt.Sprintf("%7d %-10.10s %5.1f %9s %4d %6d %-15s %-16.16s %s",
+		row.PID, row.User, row.CPU, formatMemory(row.RSS), row.Threads, row.Files, ports, row.Name, strings.Join(strings.Fields(row.Cmdline), " "))
+	return strings.TrimRight(line, " ")
+}
+
+func formatMemory(bytes uint64) string {
+	switch {
+	case bytes >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(bytes)/(1<<30))
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1<<20))
+	}
+	return fmt.Sprintf("%d KB", bytes/1024)
+}
+
+// writeTopTable prints the rows, cutting lines at width when it is set.
+func writeTopTable(w io.Writer, rows []topRow, width int) {
+	fmt.Fprintln(w, fitWidth(topHeader, width))
+	for _, row := range rows {
+		fmt.Fprintln(w, fitWidth(formatTopRow(row), width))
+	}
+}
+
+func fitWidth(line string, width int) string {
+	if runes := []rune(line); width > 0 && len(runes) > width {
+		return string(runes[:width])
+	}
+	return line
+}
@@ -0,0 +1,344 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// topViewState is what the user can change while the view runs.
+type topViewState struct {
+	filter  topRowFilter
+	sortBy  string
+	reverse bool
+}
+
+// topSortKeys maps keys to the column they sort by.
+var topSortKeys = map[string]string{
+	"c": "cpu",
+	"m": "mem",
+	"t": "threads",
+	"o": "files",
+	"p": "ports",
+	"i": "pid",
+	"n": "name",
+}
+
+type topView struct {
+	topViewState
+	sampler   *topSampler
+	config    *killConfig
+	ancestors map[int32]bool
+	rows      []topRow
+	selected  int32
+	cursor    int
+	offset    int
+	width     int
+	height    int
+	status    string
+
+	// editing is set while the filter text is typed, confirm while a kill
+	// waits for y/n.
+	editing  bool
+	input    []rune
+	previous string
+	confirm  *topRow
+	signal   syscall.Signal
+}
+
+// runTopView refreshes the process table every --interval until the user
+// quits, handling keys in between.
+func runTopView(sampler *topSampler, state topViewState, config *killConfig) error {
+	restore, err := makeTerminalRaw()
+	if err != nil {
+		return fmt.Errorf("the interactive view is unavailable (%v), use --once for a snapshot", err)
+	}
+	os.Stdout.WriteString("\033[?25l")
+	defer func() {
+		os.Stdout.WriteString("\033[H\033[2J\033[?25h")
+		restore()
+	}()
+
+	// Kills run in the background; their progress would scramble the view.
+	killLog = io.Discard
+
+	keys := make(chan string)
+	go func() {
+		buffer := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buffer)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- string(buffer[:n])
+		}
+	}()
+	results := make(chan string)
+
+	// The size is read again only on resizes and refresh ticks, as each
+	// read runs stty.
+	resized := make(chan os.Signal, 1)
+	notifyResize(resized)
+	defer signal.Stop(resized)
+
+	view := &topView{topViewState: state, sampler: sampler, config: config, ancestors: selfAndAncestors()}
+	view.width, view.height = terminalSize()
+	view.refresh()
+	// The first sample has no CPU usage yet, so take the next one soon.
+	timer := time.NewTimer(500 * time.Millisecond)
+	for {
+		view.draw()
+		select {
+		case <-resized:
+			view.width, view.height = terminalSize()
+		case key, ok := <-keys:
+			if !ok || view.handle(key, results) {
+				return nil
+			}
+		case status := <-results:
+			view.status = status
+			view.refresh()
+		case <-timer.C:
+			view.width, view.height = terminalSize()
+			view.refresh()
+			timer.Reset(topInterval)
+		}
+	}
+}
+
+// refresh samples the processes again and keeps the selection on the same
+// process when it is still shown.
+func (v *topView) refresh() {
+	rows, err := v.sampler.sample(v.filter)
+	if err != nil {
+		v.status = fmt.Sprintf("Error: %v", err)
+		return
+	}
+	v.rows = rows
+	v.resort()
+}
+
+func (v *topView) resort() {
+	sortTopRows(v.rows, v.sortBy, v.reverse)
+	v.cursor = 0
+	for i, row := range v.rows {
+		if row.PID == v.selected {
+			v.cursor = i
+			break
+		}
+	}
+	v.selectRow()
+}
+
+func (v *topView) selectRow() {
+	if v.cursor >= len(v.rows) {
+		v.cursor = len(v.rows) - 1
+	}
+	if v.cursor < 0 {
+		v.cursor = 0
+	}
+	v.selected = 0
+	if v.cursor < len(v.rows) {
+		v.selected = v.rows[v.cursor].PID
+	}
+}
+
+// handle applies one key press and reports whether the view should close.
+func (v *topView) handle(key string, results chan<- string) bool {
+	if v.editing {
+		v.editFilter(key)
+		return false
+	}
+	if v.confirm != nil {
+		if key == "y" || key == "Y" {
+			v.kill(*v.confirm, v.signal, results)
+		} else {
+			v.status = ""
+		}
+		v.confirm = nil
+		return false
+	}
+
+	switch key {
+	case "q", "Q", "\x03", "\x04":
+		return true
+	case "\x1b":
+		v.status = ""
+	case "\x1b[A", "\x1bOA", "\x10":
+		v.cursor--
+		v.selectRow()
+	case "\x1b[B", "\x1bOB", "\x0e":
+		v.cursor++
+		v.selectRow()
+	case "\x1b[5~":
+		v.cursor -= v.pageSize()
+		v.selectRow()
+	case "\x1b[6~":
+		v.cursor += v.pageSize()
+		v.selectRow()
+	case "r":
+		v.reverse = !v.reverse
+		v.resort()
+	case "d":
+		v.filter.Dev = !v.filter.Dev
+		v.refresh()
+	case "l":
+		v.filter.Listening = !v.filter.Listening
+		v.refresh()
+	case "/":
+		v.editing = true
+		v.previous = v.filter.Text
+		v.input = []rune(v.filter.Text)
+	case "k", "K":
+		if v.cursor >= len(v.rows) {
+			break
+		}
+		row := v.rows[v.cursor]
+		if reason := protectedReason(killTarget{PID: row.PID, Name: row.Name}, v.config, v.ancestors); reason != "" {
+			v.status = fmt.Sprintf("Process %d (%s) is protected: %s. Use devtool kill --force.", row.PID, row.Name, reason)
+			break
+		}
+		v.confirm = &row
+		v.signal = syscall.SIGTERM
+		if key == "K" {
+			v.signal = syscall.SIGKILL
+		}
+	default:
+		if column, ok := topSortKeys[key]; ok {
+			if v.sortBy == column {
+				v.reverse = !v.reverse
+			} else {
+				v.sortBy, v.reverse = column, false
+			}
+			v.resort()
+		}
+	}
+	return false
+}
+
+// editFilter handles keys while the filter text is typed. The view follows
+// the text as it changes; Enter keeps it and Esc restores the previous one.
+func (v *topView) editFilter(key string) {
+	switch {
+	case key == "\r" || key == "\n":
+		v.editing = false
+		return
+	case key == "\x1b" || key == "\x03":
+		v.editing = false
+		v.input = []rune(v.previous)
+	case key == "\x7f" || key == "\x08":
+		if len(v.input) > 0 {
+			v.input = v.input[:len(v.input)-1]
+		}
+	case key == "\x15":
+		v.input = nil
+	case strings.HasPrefix(key, "\x1b"):
+		// Ignore other escape sequences such as arrow keys.
+		return
+	default:
+		for _, r := range key {
+			if r >= ' ' {
+				v.input = append(v.input, r)
+			}
+		}
+	}
+	v.filter.Text = string(v.input)
+	v.refresh()
+}
+
+// kill terminates row in the background and sends a status line to results.
+func (v *topView) kill(row topRow, sig syscall.Signal, results chan<- string) {
+	v.status = fmt.Sprintf("Sending %s to process %d (%s)...", signalName(sig), row.PID, row.Name)
+	go func() {
+		targets, err := killSelection{PIDs: []int32{row.PID}}.find()
+		if err != nil || len(targets) == 0 {
+			results <- fmt.Sprintf("Process %d (%s) has already exited.", row.PID, row.Name)
+			return
+		}
+		result := terminateProcesses(targets, sig, topGrace)[0]
+		switch {
+		case errors.Is(result.Err, syscall.EPERM) || errors.Is(result.Err, os.ErrPermission):
+			results <- fmt.Sprintf("Permission denied killing process %d (%s), owned by %s.", row.PID, row.Name, row.User)
+		case result.Err != nil:
+			results <- fmt.Sprintf("Error: %v", result.Err)
+		case result.Signal == syscall.SIGKILL && sig != syscall.SIGKILL:
+			results <- fmt.Sprintf("Process %d (%s) killed with SIGKILL after %s.", row.PID, row.Name, topGrace)
+		default:
+			results <- fmt.Sprintf("Process %d (%s) exited (%s).", row.PID, row.Name, result.Elapsed.Round(time.Millisecond))
+		}
+	}()
+}
+
+// pageSize is the number of process rows that fit on the screen.
+func (v *topView) pageSize() int {
+	if rows := v.height - 4; rows > 1 {
+		return rows
+	}
+	return 1
+}
+
+func (v *topView) draw() {
+	rows := v.pageSize()
+	if v.cursor < v.offset {
+		v.offset = v.cursor
+	}
+	if v.cursor >= v.offset+rows {
+		v.offset = v.cursor - rows + 1
+	}
+
+	var filters []string
+	if v.filter.Dev {
+		filters = append(filters, "dev")
+	}
+	if v.filter.Listening {
+		filters = append(filters, "listening")
+	}
+	if v.filter.User != "" {
+		filters = append(filters, "user "+v.filter.User)
+	}
+	if v.filter.Text != "" {
+		filters = append(filters, fmt.Sprintf("%q", v.filter.Text))
+	}
+	summary := fmt.Sprintf("devtool top - %s - %d processes, sorted by %s", time.Now().Format("15:04:05"), len(v.rows), v.sortBy)
+	if v.reverse {
+		summary += " (reversed)"
+	}
+	if len(filters) > 0 {
+		summary += ", showing " + strings.Join(filters, ", ")
+	}
+
+	var screen strings.Builder
+	screen.WriteString("\033[H\033[2J")
+	screen.WriteString(fitWidth(summary, v.width) + "\r\n")
+	screen.WriteString("\033[7m" + fitWidth(fmt.Sprintf("%-*s", v.width, topHeader), v.width) + "\033[0m\r\n")
+	for i := v.offset; i < len(v.rows) && i < v.offset+rows; i++ {
+		line := fitWidth(formatTopRow(v.rows[i]), v.width)
+		if i == v.cursor {
+			line = "\033[1;36m" + line + "\033[0m"
+		}
+		screen.WriteString(line + "\r\n")
+	}
+
+	// The status line sits at the bottom of the screen.
+	screen.WriteString(fmt.Sprintf("\033[%d;1H", v.height))
+	switch {
+	case v.editing:
+		prompt := "Filter: " + string(v.input)
+		screen.WriteString(fitWidth(prompt, v.width))
+		screen.WriteString(fmt.Sprintf("\033[%d;%dH\033[?25h", v.height, utf8.RuneCountInString(prompt)+1))
+	case v.confirm != nil:
+		screen.WriteString("\033[?25l\033[1;33m" + fitWidth(fmt.Sprintf("Send %s to process %d (%s)? [y/N]", signalName(v.signal), v.confirm.PID, v.confirm.Name), v.width) + "\033[0m")
+	case v.status != "":
+		screen.WriteString("\033[?25l" + fitWidth(v.status, v.width))
+	default:
+		screen.WriteString("\033[?25l\033[2m" + fitWidth("k kill  K SIGKILL  c/m/t/o/p/i/n sort  r reverse  d dev  l listening  / filter  q quit", v.width) + "\033[0m")
+	}
+	os.Stdout.WriteString(screen.String())
+}